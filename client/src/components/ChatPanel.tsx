@@ -2,6 +2,7 @@ import { useState } from "react";
 import { usePlayerStore } from "../stores/playerStore";
 import { sendMessage } from "../service/websocket";
 import useMessagesStore from "../stores/messagesStore";
+import useTeamsStore from "../stores/teamsStore";
 import type { ChatMessage, Message } from "../types";
 import { toast } from "sonner";
 
@@ -9,6 +10,9 @@ export function ChatPanel() {
   const { messages } = useMessagesStore();
   const [message, setMessage] = useState("");
   const { playerInfo } = usePlayerStore();
+  const { members } = useTeamsStore();
+  const [teamOnly, setTeamOnly] = useState(false);
+  const myTeam = playerInfo ? members[playerInfo.id] : undefined;
 
   const handleSendMessage = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -20,6 +24,7 @@ export function ChatPanel() {
       playerEmoji: playerInfo.emoji,
       message: message.trim(),
       timestamp: new Date(),
+      team: teamOnly && !!myTeam,
     }
 
     try {
@@ -71,6 +76,9 @@ export function ChatPanel() {
                       </span>
                     </div>
                   )}
+                  {message.team && (
+                    <div className="text-xs font-semibold uppercase opacity-70">Team</div>
+                  )}
                   <p className="text-sm leading-relaxed">{message.message}</p>
                 </div>
                 <div
@@ -87,6 +95,16 @@ export function ChatPanel() {
 
       {/* Message Input */}
       <div className="p-4 border-t border-gray-200">
+        {myTeam && (
+          <label className="flex items-center gap-2 mb-2 text-sm text-gray-600">
+            <input
+              type="checkbox"
+              checked={teamOnly}
+              onChange={(e) => setTeamOnly(e.target.checked)}
+            />
+            Only my team ({myTeam})
+          </label>
+        )}
         <form onSubmit={handleSendMessage} className="flex gap-2">
           <input
             type="text"
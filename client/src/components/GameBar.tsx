@@ -0,0 +1,119 @@
+import { useEffect, useState } from "react";
+import { sendMessage } from "../service/websocket";
+import useGameStore from "../stores/gameStore";
+import useModerationStore from "../stores/moderationStore";
+import { usePlayerStore } from "../stores/playerStore";
+import type { Message } from "../types";
+
+export function GameBar() {
+  const { game, secretWord, wordChoices, hint } = useGameStore();
+  const { playerInfo } = usePlayerStore();
+  const { moderation } = useModerationStore();
+  const [now, setNow] = useState(Date.now());
+
+  useEffect(() => {
+    const timer = setInterval(() => setNow(Date.now()), 250);
+    return () => clearInterval(timer);
+  }, []);
+
+  const startGame = (mode: "pictionary" | "prompt") => {
+    sendMessage({ type: "game_start", payload: { mode } } as Message).catch((error) => {
+      console.error("Failed to start game:", error);
+    });
+  };
+
+  const voteClear = () => {
+    sendMessage({ type: "vote_clear", payload: {} } as Message).catch((error) => {
+      console.error("Failed to start vote:", error);
+    });
+  };
+
+  if (game.phase === "idle") {
+    return (
+      <div className="bg-white rounded-lg shadow-lg p-3 w-full flex items-center justify-between">
+        <span className="text-gray-600 text-sm">Free drawing</span>
+        {moderation.hostId === playerInfo?.id ? (
+          <div className="flex items-center gap-2">
+            <button
+              onClick={() => startGame("prompt")}
+              className="px-4 py-2 rounded-md border-2 border-blue-500 text-blue-600 text-sm font-semibold hover:bg-blue-50"
+            >
+              Start prompt challenge
+            </button>
+            <button
+              onClick={() => startGame("pictionary")}
+              className="px-4 py-2 rounded-md bg-blue-500 text-white text-sm font-semibold hover:bg-blue-600"
+            >
+              Start game
+            </button>
+          </div>
+        ) : (
+          <div className="flex items-center gap-3">
+            <span className="text-gray-400 text-sm">Waiting for the host to start a game</span>
+            <button
+              onClick={voteClear}
+              className="px-3 py-2 rounded-md text-gray-600 text-sm hover:bg-gray-100"
+            >
+              Vote to clear
+            </button>
+          </div>
+        )}
+      </div>
+    );
+  }
+
+  const chooseWord = (word: string) => {
+    sendMessage({ type: "choose_word", payload: { word } } as Message).catch((error) => {
+      console.error("Failed to choose word:", error);
+    });
+  };
+
+  const secondsLeft = game.phaseEndsAt
+    ? Math.max(0, Math.ceil((new Date(game.phaseEndsAt).getTime() - now) / 1000))
+    : 0;
+  const isDrawer = game.drawerId === playerInfo?.id;
+
+  let status = "Next turn starting...";
+  if (game.phase === "choosing") {
+    status = `${game.drawerEmoji} ${game.drawerName} is choosing a word`;
+  } else if (game.phase === "drawing") {
+    status = isDrawer
+      ? `Draw: ${secretWord ?? "..."}`
+      : `${game.drawerEmoji} ${game.drawerName} is drawing: ${hint ?? `${game.wordLength} letters`}`;
+  } else if (game.phase === "prompt_drawing") {
+    status = `Everyone draw: ${game.theme}`;
+  } else if (game.phase === "prompt_voting") {
+    status = `Vote for your favourite "${game.theme}"`;
+  } else if (game.phase === "prompt_results") {
+    status = `Results for "${game.theme}"`;
+  }
+
+  return (
+    <div className="bg-white rounded-lg shadow-lg p-3 w-full flex items-center justify-between gap-4">
+      <span className="text-gray-600 text-sm">
+        Round {game.round}/{game.totalRounds}
+      </span>
+      {game.phase === "choosing" && isDrawer ? (
+        <span className="flex gap-2">
+          {wordChoices.map((word) => (
+            <button
+              key={word}
+              onClick={() => chooseWord(word)}
+              className="px-3 py-1 rounded-md border-2 border-blue-500 text-blue-600 text-sm font-semibold hover:bg-blue-50"
+            >
+              {word}
+            </button>
+          ))}
+        </span>
+      ) : (
+        <span className="font-bold text-gray-800 whitespace-pre">{status}</span>
+      )}
+      {game.teamScores && (
+        <span className="text-gray-600 text-sm">
+          {Object.entries(game.teamScores).map(([team, score]) => `${team} ${score}`).join(" · ")}
+        </span>
+      )}
+      <span className="font-mono text-gray-800">{secondsLeft}s</span>
+    </div>
+  );
+}
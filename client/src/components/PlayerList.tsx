@@ -1,6 +1,10 @@
 import { useEffect, useState } from "react";
 import { usePlayerStore } from "../stores/playerStore";
 import useActivePlayersStore from "../stores/activePlayersStore";
+import useModerationStore from "../stores/moderationStore";
+import useTeamsStore from "../stores/teamsStore";
+import { getRoomApi, sendMessage } from "../service/websocket";
+import type { Message } from "../types";
 import { PlayerListSkeleton } from "./PlayerListSkeleton";
 
 const BASE_URL = "http://" + (window.location.hostname + ':8080');
@@ -8,13 +12,18 @@ const BASE_URL = "http://" + (window.location.hostname + ':8080');
 export function PlayerList() {
   const { playerInfo } = usePlayerStore();
   const { activePlayers, setActivePlayers } = useActivePlayersStore();
+  const { moderation } = useModerationStore();
+  const { teams, members } = useTeamsStore();
   const [isLoading, setIsLoading] = useState(true);
 
   useEffect(() => {
     // Fetch active players on component mount
     const fetchActivePlayers = async () => {
       try {
-        const response = await fetch(`${BASE_URL}/players`);
+        const roomApi = getRoomApi();
+        const response = await fetch(`${BASE_URL}/players`, {
+          headers: roomApi ? { Authorization: `Bearer ${roomApi.token}` } : {},
+        });
         if (response.ok) {
           const players = await response.json();
           setActivePlayers(players || []);
@@ -30,6 +39,33 @@ export function PlayerList() {
   }, [setActivePlayers]);
 
   const totalPlayers = activePlayers.length;
+  const isHost = moderation.hostId !== "" && moderation.hostId === playerInfo?.id;
+
+  const moderate = (type: "kick" | "ban" | "mute" | "unmute" | "transfer_host" | "vote_kick", playerId: string) => {
+    sendMessage({ type, payload: { playerId } } as Message).catch((error) => {
+      console.error(`Failed to ${type} player:`, error);
+    });
+  };
+
+  const assignTeam = (playerId: string, team: string) => {
+    sendMessage({ type: "assign_team", payload: { playerId, team } } as Message).catch((error) => {
+      console.error("Failed to assign team:", error);
+    });
+  };
+
+  const createInvite = () => {
+    sendMessage({ type: "create_invite", payload: {} } as Message).catch((error) => {
+      console.error("Failed to create invite:", error);
+    });
+  };
+
+  const changePassword = () => {
+    const password = window.prompt("New room password (leave empty to make the room public):");
+    if (password === null) return;
+    sendMessage({ type: "set_password", payload: { password } } as Message).catch((error) => {
+      console.error("Failed to set password:", error);
+    });
+  };
 
   if (isLoading) {
     return <PlayerListSkeleton />;
@@ -45,6 +81,30 @@ export function PlayerList() {
             {totalPlayers}
           </span>
         </h2>
+        {isHost && (
+          <div className="mt-3 flex flex-wrap items-center gap-2 text-xs">
+            <button
+              onClick={createInvite}
+              className="px-2 py-1 rounded bg-white border border-gray-300 text-gray-700 hover:bg-gray-100"
+            >
+              Copy invite link
+            </button>
+            <button
+              onClick={changePassword}
+              className="px-2 py-1 rounded bg-white border border-gray-300 text-gray-700 hover:bg-gray-100"
+            >
+              {moderation.passwordProtected ? "Change password" : "Set password"}
+            </button>
+            <label className="flex items-center gap-1 text-gray-600">
+              <input
+                type="checkbox"
+                checked={moderation.inviteOnly}
+                onChange={(e) => sendMessage({ type: "invite_only", payload: { enabled: e.target.checked } } as Message)}
+              />
+              Invite only
+            </label>
+          </div>
+        )}
       </div>
 
       {/* All players list */}
@@ -57,7 +117,10 @@ export function PlayerList() {
                 <div className="font-medium text-gray-800">
                   {playerInfo.name}
                 </div>
-                <div className="text-blue-600 text-sm">You</div>
+                <div className="text-blue-600 text-sm">
+                  {isHost ? "You (host)" : "You"}
+                  {members[playerInfo.id] && ` · ${members[playerInfo.id]} team`}
+                </div>
               </div>
               <div className="flex items-center gap-2">
                 <div className="w-3 h-3 bg-green-500 rounded-full"></div>
@@ -76,7 +139,63 @@ export function PlayerList() {
               <span className="text-xl">{player.playerEmoji}</span>
               <div className="flex-1">
                 <div className="font-medium text-gray-800">{player.playerName}</div>
+                {player.id === moderation.hostId && (
+                  <div className="text-amber-600 text-sm">Host</div>
+                )}
+                {moderation.muted.includes(player.id) && (
+                  <div className="text-gray-500 text-sm">Muted</div>
+                )}
+                {members[player.id] && !isHost && (
+                  <div className="text-gray-500 text-sm">{members[player.id]} team</div>
+                )}
+                {members[player.id] && isHost && (
+                  <select
+                    value={members[player.id]}
+                    onChange={(e) => assignTeam(player.id, e.target.value)}
+                    className="text-sm text-gray-600 border border-gray-300 rounded"
+                  >
+                    {teams.map((team) => (
+                      <option key={team} value={team}>{team} team</option>
+                    ))}
+                  </select>
+                )}
               </div>
+              {isHost && (
+                <div className="flex items-center gap-1">
+                  <button
+                    onClick={() => moderate(moderation.muted.includes(player.id) ? "unmute" : "mute", player.id)}
+                    className="px-2 py-1 rounded text-xs text-gray-600 hover:bg-gray-200"
+                  >
+                    {moderation.muted.includes(player.id) ? "Unmute" : "Mute"}
+                  </button>
+                  <button
+                    onClick={() => moderate("transfer_host", player.id)}
+                    className="px-2 py-1 rounded text-xs text-gray-600 hover:bg-gray-200"
+                  >
+                    Make host
+                  </button>
+                  <button
+                    onClick={() => moderate("kick", player.id)}
+                    className="px-2 py-1 rounded text-xs text-red-600 hover:bg-red-50"
+                  >
+                    Kick
+                  </button>
+                  <button
+                    onClick={() => moderate("ban", player.id)}
+                    className="px-2 py-1 rounded text-xs text-red-600 hover:bg-red-50"
+                  >
+                    Ban
+                  </button>
+                </div>
+              )}
+              {!isHost && (
+                <button
+                  onClick={() => moderate("vote_kick", player.id)}
+                  className="px-2 py-1 rounded text-xs text-red-600 hover:bg-red-50"
+                >
+                  Vote kick
+                </button>
+              )}
               <div className="flex items-center gap-2">
                 <div className="w-3 h-3 rounded-full bg-green-500"></div>
                 <span className="text-sm font-medium text-green-600">
@@ -0,0 +1,85 @@
+import { getRoomApi, sendMessage } from "../service/websocket";
+import useGameStore from "../stores/gameStore";
+import { usePlayerStore } from "../stores/playerStore";
+import type { Message } from "../types";
+
+const BASE_URL = "http://" + (window.location.hostname + ':8080');
+
+// images can't send headers, so private rooms get the connection token in the URL
+function imageUrl(path: string) {
+  const roomApi = getRoomApi();
+  return roomApi ? `${BASE_URL}${path}?token=${encodeURIComponent(roomApi.token)}` : `${BASE_URL}${path}`;
+}
+
+export function PromptGallery() {
+  const { game, gallery, promptVote } = useGameStore();
+  const { playerInfo } = usePlayerStore();
+
+  if (!gallery || (game.phase !== "prompt_voting" && game.phase !== "prompt_results")) {
+    return null;
+  }
+
+  const voting = game.phase === "prompt_voting";
+
+  const vote = (playerId: string) => {
+    sendMessage({ type: "prompt_vote", payload: { playerId } } as Message).catch((error) => {
+      console.error("Failed to vote:", error);
+    });
+  };
+
+  return (
+    <div className="bg-white rounded-lg shadow-lg p-3 w-full">
+      <div className="flex items-center justify-between mb-2">
+        <span className="font-bold text-gray-800">{gallery.theme}</span>
+        <a
+          href={imageUrl(gallery.imageUrl)}
+          target="_blank"
+          rel="noreferrer"
+          className="text-blue-600 text-sm hover:underline"
+        >
+          Whole canvas
+        </a>
+      </div>
+      <div className="grid grid-cols-3 gap-3">
+        {gallery.entries.map((entry) => {
+          const isWinner = gallery.winners.includes(entry.playerId);
+          return (
+            <div
+              key={entry.playerId}
+              className={`rounded-md border-2 p-2 flex flex-col gap-2 ${isWinner ? "border-amber-400" : "border-gray-200"}`}
+            >
+              <img
+                src={imageUrl(entry.imageUrl)}
+                alt={`${entry.playerName}'s drawing`}
+                className="w-full aspect-square object-contain bg-gray-50"
+              />
+              <div className="flex items-center justify-between text-sm">
+                <span className="text-gray-700">
+                  {entry.playerEmoji} {entry.playerName}
+                </span>
+                {voting ? (
+                  entry.playerId !== playerInfo?.id && (
+                    <button
+                      onClick={() => vote(entry.playerId)}
+                      className={`px-2 py-1 rounded-md text-xs font-semibold ${
+                        promptVote === entry.playerId
+                          ? "bg-blue-500 text-white"
+                          : "border border-blue-500 text-blue-600 hover:bg-blue-50"
+                      }`}
+                    >
+                      {promptVote === entry.playerId ? "Voted" : "Vote"}
+                    </button>
+                  )
+                ) : (
+                  <span className="text-gray-600">
+                    {entry.votes} {entry.votes === 1 ? "vote" : "votes"}
+                  </span>
+                )}
+              </div>
+            </div>
+          );
+        })}
+      </div>
+    </div>
+  );
+}
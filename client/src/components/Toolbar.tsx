@@ -3,6 +3,9 @@ interface ToolbarProps {
   onColorChange: (color: string) => void;
   strokeWidth: number;
   onStrokeWidthChange: (width: number) => void;
+  tool: "pen" | "fill";
+  onToolChange: (tool: "pen" | "fill") => void;
+  onImage: (file: File) => void;
   onClear: () => void;
   onCopy: () => void;
   onDownload: () => void;
@@ -30,6 +33,9 @@ export function Toolbar({
   onColorChange,
   strokeWidth,
   onStrokeWidthChange,
+  tool,
+  onToolChange,
+  onImage,
   onClear,
   onCopy,
   onDownload,
@@ -81,6 +87,41 @@ export function Toolbar({
         </div>
       </div>
 
+      <div className="flex flex-col items-center">
+        <h3 className="text-gray-600 font-bold text-sm mb-2">Tool</h3>
+        <div className="flex gap-2">
+          {(["pen", "fill"] as const).map((option) => (
+            <button
+              key={option}
+              onClick={() => onToolChange(option)}
+              className={`px-3 py-2 rounded-md border-2 text-sm font-semibold capitalize ${
+                tool === option
+                  ? "border-blue-500 bg-blue-50"
+                  : "border-gray-200 bg-white"
+              }`}
+            >
+              {option}
+            </button>
+          ))}
+          <label
+            className="px-3 py-2 rounded-md border-2 border-gray-200 bg-white text-sm font-semibold cursor-pointer"
+            title="Upload a PNG or JPEG sticker"
+          >
+            Sticker
+            <input
+              type="file"
+              accept="image/png,image/jpeg"
+              className="hidden"
+              onChange={(e) => {
+                const file = e.target.files?.[0];
+                if (file) onImage(file);
+                e.target.value = "";
+              }}
+            />
+          </label>
+        </div>
+      </div>
+
       <div className="flex flex-col items-center gap-2">
         <h3 className="text-gray-600 font-bold text-sm mb-2">Actions</h3>
         <div className="flex gap-2">
@@ -0,0 +1,51 @@
+import { useEffect, useState } from "react";
+import { sendMessage } from "../service/websocket";
+import useModerationStore from "../stores/moderationStore";
+import { usePlayerStore } from "../stores/playerStore";
+import type { Message } from "../types";
+
+export function VoteBanner() {
+  const { vote } = useModerationStore();
+  const { playerInfo } = usePlayerStore();
+  const [now, setNow] = useState(Date.now());
+
+  useEffect(() => {
+    const timer = setInterval(() => setNow(Date.now()), 250);
+    return () => clearInterval(timer);
+  }, []);
+
+  if (!vote) {
+    return null;
+  }
+
+  const voteYes = () => {
+    const message = vote.type === "kick"
+      ? { type: "vote_kick", payload: { playerId: vote.targetId } }
+      : { type: "vote_clear", payload: {} };
+    sendMessage(message as Message).catch((error) => {
+      console.error("Failed to vote:", error);
+    });
+  };
+
+  const secondsLeft = Math.max(0, Math.ceil((new Date(vote.endsAt).getTime() - now) / 1000));
+  const subject = vote.type === "kick" ? `kick ${vote.targetName}` : "clear the canvas";
+
+  return (
+    <div className="bg-amber-50 border border-amber-200 rounded-lg shadow-lg p-3 w-full flex items-center justify-between gap-4">
+      <span className="text-amber-800 text-sm">
+        Vote to {subject}: {vote.votes}/{vote.needed} votes
+      </span>
+      <div className="flex items-center gap-3">
+        <span className="text-amber-700 text-sm font-mono">{secondsLeft}s</span>
+        {vote.targetId !== playerInfo?.id && (
+          <button
+            onClick={voteYes}
+            className="px-3 py-1 rounded-md bg-amber-500 text-white text-sm font-semibold hover:bg-amber-600"
+          >
+            Vote yes
+          </button>
+        )}
+      </div>
+    </div>
+  );
+}
@@ -1,17 +1,92 @@
 import { useRef, useEffect, useState, useCallback } from "react";
-import { getSocket, sendMessage } from "../service/websocket";
+import { getRoomApi, getSocket, sendMessage } from "../service/websocket";
 import type { Message } from "../types";
 import { usePlayerStore } from "../stores/playerStore";
 import { throttle } from "lodash";
 
 
 const socket = getSocket();
+const BASE_URL = "http://" + (window.location.hostname + ':8080');
+
+// Uploaded images are immutable, so each one is only fetched once
+const imageCache = new Map<string, Promise<HTMLImageElement>>();
+
+function loadImage(imageId: string): Promise<HTMLImageElement> {
+  let image = imageCache.get(imageId);
+  if (!image) {
+    image = new Promise((resolve, reject) => {
+      const img = new Image();
+      // served with CORS headers so drawing it doesn't taint the canvas for copy/download
+      img.crossOrigin = "anonymous";
+      img.onload = () => resolve(img);
+      img.onerror = reject;
+      img.src = `${BASE_URL}/images/${imageId}`;
+    });
+    imageCache.set(imageId, image);
+  }
+  return image;
+}
+
+// Draws an image centred on (x, y), scaled and rotated clockwise by rotation degrees, like the server does
+function drawPlacedImage(
+  ctx: CanvasRenderingContext2D,
+  img: HTMLImageElement,
+  x: number,
+  y: number,
+  scale: number,
+  rotation: number
+) {
+  ctx.save();
+  ctx.translate(x, y);
+  ctx.rotate((rotation * Math.PI) / 180);
+  ctx.scale(scale, scale);
+  ctx.drawImage(img, -img.width / 2, -img.height / 2);
+  ctx.restore();
+}
+
+// Paints a fill region computed by the server: flattened y, x0, x1 row spans
+function drawSpans(ctx: CanvasRenderingContext2D, spans: number[], color: string) {
+  ctx.save();
+  ctx.fillStyle = color;
+  for (let i = 0; i + 2 < spans.length; i += 3) {
+    ctx.fillRect(spans[i + 1], spans[i], spans[i + 2] - spans[i + 1], 1);
+  }
+  ctx.restore();
+}
+
+function drawPath(
+  ctx: CanvasRenderingContext2D,
+  points: { x: number; y: number }[],
+  color: string,
+  strokeWidth: number
+) {
+  if (points.length === 0) return;
+
+  ctx.save();
+  ctx.strokeStyle = color;
+  ctx.lineWidth = strokeWidth;
+
+  ctx.beginPath();
+  ctx.moveTo(points[0].x, points[0].y);
+  if (points.length === 1) {
+    // Draw a dot for a single point
+    ctx.fillStyle = color;
+    ctx.arc(points[0].x, points[0].y, strokeWidth / 2, 0, 2 * Math.PI);
+    ctx.fill();
+  }
+  for (let i = 1; i < points.length; i++) {
+    ctx.lineTo(points[i].x, points[i].y);
+  }
+  ctx.stroke();
+  ctx.restore();
+}
 
 export function useCanvas() {
   const canvasRef = useRef<HTMLCanvasElement>(null);
   const [isDrawing, setIsDrawing] = useState(false);
   const [selectedColor, setSelectedColor] = useState("#FF6B6B");
   const [strokeWidth, setStrokeWidth] = useState(5);
+  const [tool, setTool] = useState<"pen" | "fill">("pen");
   const { playerInfo } = usePlayerStore();
 
   // Buffering for path drawing
@@ -60,6 +135,18 @@ export function useCanvas() {
         x: e.clientX - rect.left,
         y: e.clientY - rect.top,
       };
+      if (tool === "fill") {
+        // The server works out the region and sends it back to everyone, this client included
+        if (playerInfo) {
+          sendMessage({
+            type: "fill",
+            payload: { x: coords.x, y: coords.y, color: selectedColor },
+          } as Message).catch(error => {
+            console.error("Failed to send fill:", error);
+          });
+        }
+        return;
+      }
       ctx.beginPath();
       ctx.moveTo(coords.x, coords.y);
       setIsDrawing(true);
@@ -107,28 +194,50 @@ export function useCanvas() {
         ctx.stroke();
       } else if (data.type === "path" && ctx) {
         const payload = data.payload;
-        if (payload.points.length > 0) {
-          ctx.save();
-          ctx.strokeStyle = payload.color;
-          ctx.lineWidth = payload.strokeWidth;
-
-          ctx.beginPath();
-          ctx.moveTo(payload.points[0].x, payload.points[0].y);
-          if (payload.points.length === 1) {
-            // Draw a dot for a single point
-            ctx.fillStyle = payload.color;
-            ctx.arc(payload.points[0].x, payload.points[0].y, payload.strokeWidth / 2, 0, 2 * Math.PI);
-            ctx.fill();
-          }
-          for (let i = 1; i < payload.points.length; i++) {
-            ctx.lineTo(payload.points[i].x, payload.points[i].y);
-          }
-          ctx.stroke();
-          ctx.restore();
-        }
+        drawPath(ctx, payload.points, payload.color, payload.strokeWidth);
+      } else if (data.type === "fill" && ctx) {
+        drawSpans(ctx, data.payload.spans, data.payload.color);
+      } else if (data.type === "image_place" && ctx) {
+        const payload = data.payload;
+        loadImage(payload.imageId)
+          .then(img => drawPlacedImage(ctx, img, payload.x, payload.y, payload.scale, payload.rotation))
+          .catch(error => console.error("Failed to load image:", error));
       } else if (data.type === "clear" && ctx && canvas) {
         // Clear the canvas when receiving a clear event
         ctx.clearRect(0, 0, canvas.width, canvas.height);
+      } else if (data.type === "room_info" && canvas) {
+        // Size the canvas to the room; this is set directly because resizing wipes the bitmap,
+        // which must happen before the canvas_sync that follows is drawn
+        canvas.width = data.payload.canvasWidth;
+        canvas.height = data.payload.canvasHeight;
+        canvas.style.backgroundColor = data.payload.background;
+        ctx.strokeStyle = selectedColor;
+        ctx.lineWidth = strokeWidth;
+        ctx.lineCap = "round";
+        ctx.lineJoin = "round";
+      } else if (data.type === "canvas_sync" && ctx && canvas) {
+        // Load every image first so the history can be replayed in order
+        const ops = data.payload.ops;
+        const imageIds = [...new Set(ops.flatMap(op => (op.type === "image" && op.imageId ? [op.imageId] : [])))];
+        Promise.allSettled(imageIds.map(loadImage)).then(results => {
+          const images = new Map<string, HTMLImageElement>();
+          results.forEach((result, i) => {
+            if (result.status === "fulfilled") images.set(imageIds[i], result.value);
+          });
+
+          // Replace whatever is on screen with the server's history
+          ctx.clearRect(0, 0, canvas.width, canvas.height);
+          for (const op of ops) {
+            if (op.type === "path" && op.points) {
+              drawPath(ctx, op.points, op.color ?? "#000000", op.strokeWidth ?? 1);
+            } else if (op.type === "fill" && op.spans) {
+              drawSpans(ctx, op.spans, op.color ?? "#000000");
+            } else if (op.type === "image" && op.imageId && op.points) {
+              const img = images.get(op.imageId);
+              if (img) drawPlacedImage(ctx, img, op.points[0].x, op.points[0].y, op.scale ?? 1, op.rotation ?? 0);
+            }
+          }
+        });
       }
     }
 
@@ -148,7 +257,7 @@ export function useCanvas() {
       // Cancel any pending throttled calls
       sendPathThrottled.cancel();
     };
-  }, [isDrawing, playerInfo, selectedColor, strokeWidth, sendPathThrottled]);
+  }, [isDrawing, playerInfo, selectedColor, strokeWidth, tool, sendPathThrottled]);
 
   const canvasToBlob = (canvas: HTMLCanvasElement): Promise<Blob> => {
     return new Promise((resolve, reject) => {
@@ -181,6 +290,34 @@ export function useCanvas() {
     }
   };
 
+  // Uploads a sticker and places it in the middle of the canvas, at most a third of the canvas wide
+  const placeImage = async (file: File) => {
+    const canvas = canvasRef.current;
+    const roomApi = getRoomApi();
+    if (!canvas || !playerInfo || !roomApi) return;
+
+    const response = await fetch(`${BASE_URL}/rooms/${encodeURIComponent(roomApi.roomId)}/images`, {
+      method: "POST",
+      headers: { "Content-Type": file.type, Authorization: `Bearer ${roomApi.token}` },
+      body: file,
+    });
+    if (!response.ok) {
+      throw new Error(await response.text());
+    }
+    const uploaded = (await response.json()) as { imageId: string; width: number; height: number };
+
+    await sendMessage({
+      type: "image_place",
+      payload: {
+        imageId: uploaded.imageId,
+        x: canvas.width / 2,
+        y: canvas.height / 2,
+        scale: Math.min(1, canvas.width / 3 / uploaded.width),
+        rotation: 0,
+      },
+    } as Message);
+  };
+
   const copyCanvas = async () => {
     const canvas = canvasRef.current;
     if (!canvas) return;
@@ -206,6 +343,9 @@ export function useCanvas() {
     setSelectedColor,
     strokeWidth,
     setStrokeWidth,
+    tool,
+    setTool,
+    placeImage,
     clearCanvas,
     copyCanvas,
     downloadCanvas,
@@ -0,0 +1,50 @@
+import { useEffect, useMemo, useState } from "react";
+import { throttle } from "lodash";
+import { addMessageHandler, sendMessage } from "../service/websocket";
+import type { Message } from "../types";
+
+export interface RemoteCursor {
+  id: string;
+  playerName: string;
+  playerEmoji: string;
+  x: number;
+  y: number;
+}
+
+// The server coalesces cursor updates anyway, so there is no point sending faster than it flushes
+const CURSOR_SEND_INTERVAL = 50;
+
+export function useCursors() {
+  const [cursors, setCursors] = useState<Record<string, RemoteCursor>>({});
+
+  useEffect(() => {
+    return addMessageHandler((event) => {
+      const data = JSON.parse(event.data) as Message;
+
+      if (data.type === "cursor") {
+        const cursor = data.payload;
+        setCursors((current) => ({ ...current, [cursor.id]: cursor }));
+      } else if (data.type === "player_leave") {
+        const leftId = data.payload.id;
+        setCursors((current) => {
+          const { [leftId]: _, ...rest } = current;
+          return rest;
+        });
+      }
+    });
+  }, []);
+
+  const sendCursor = useMemo(
+    () =>
+      throttle((x: number, y: number) => {
+        sendMessage({ type: "cursor", payload: { x, y } } as Message).catch(() => {
+          // cursor updates are best effort
+        });
+      }, CURSOR_SEND_INTERVAL),
+    []
+  );
+
+  useEffect(() => () => sendCursor.cancel(), [sendCursor]);
+
+  return { cursors: Object.values(cursors), sendCursor };
+}
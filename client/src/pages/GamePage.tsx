@@ -3,10 +3,14 @@ import { Toolbar } from "../components/Toolbar";
 import { CurrentSelection } from "../components/CurrentSelection";
 import { ChatPanel } from "../components/ChatPanel";
 import { PlayerList } from "../components/PlayerList";
-import { Toaster } from "sonner";
+import { Toaster, toast } from "sonner";
 
 import { LogoutButton } from "../components/LogoutButton";
 import { usePlayerJoin } from "../hooks/usePlayerJoin";
+import { useCursors } from "../hooks/useCursors";
+import { GameBar } from "../components/GameBar";
+import { VoteBanner } from "../components/VoteBanner";
+import { PromptGallery } from "../components/PromptGallery";
 
 
 export function GamePage() {
@@ -16,12 +20,16 @@ export function GamePage() {
     setSelectedColor,
     strokeWidth,
     setStrokeWidth,
+    tool,
+    setTool,
+    placeImage,
     clearCanvas,
     copyCanvas,
     downloadCanvas,
   } = useCanvas();
 
   usePlayerJoin();
+  const { cursors, sendCursor } = useCursors();
 
   return (
     <main className="bg-gray-100 min-h-screen p-4">
@@ -38,17 +46,31 @@ export function GamePage() {
 
           {/* Canvas and tools */}
           <div className="flex flex-col items-center gap-4">
+            <GameBar />
+            <VoteBanner />
+            <PromptGallery />
             <Toolbar
               selectedColor={selectedColor}
               onColorChange={setSelectedColor}
               strokeWidth={strokeWidth}
               onStrokeWidthChange={setStrokeWidth}
+              tool={tool}
+              onToolChange={setTool}
+              onImage={(file) => {
+                placeImage(file).catch((error) => toast.error(`Couldn't place image: ${error.message}`));
+              }}
               onClear={clearCanvas}
               onCopy={copyCanvas}
               onDownload={downloadCanvas}
             />
 
-            <div className="relative">
+            <div
+              className="relative"
+              onMouseMove={(e) => {
+                const rect = e.currentTarget.getBoundingClientRect();
+                sendCursor(e.clientX - rect.left, e.clientY - rect.top);
+              }}
+            >
               <canvas
                 ref={canvasRef}
                 width={600}
@@ -56,6 +78,15 @@ export function GamePage() {
                 className="bg-white rounded-lg shadow-lg border-2 border-gray-200 cursor-crosshair"
                 style={{ touchAction: "none" }}
               />
+              {cursors.map((cursor) => (
+                <span
+                  key={cursor.id}
+                  className="pointer-events-none absolute text-xs whitespace-nowrap transition-all duration-75"
+                  style={{ left: cursor.x, top: cursor.y }}
+                >
+                  {cursor.playerEmoji} {cursor.playerName}
+                </span>
+              ))}
             </div>
 
             <CurrentSelection
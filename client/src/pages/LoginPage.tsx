@@ -2,6 +2,7 @@ import { useState } from "react";
 import { useNavigate } from "react-router-dom";
 import { usePlayerStore } from "../stores/playerStore";
 import { v4 as uuidv4 } from "uuid";
+import { setRoomPassword } from "../service/websocket";
 
 const emojis = [
   "😀",
@@ -140,12 +141,14 @@ export function LoginPage() {
   const [name, setName] = useState("");
   const [selectedEmoji, setSelectedEmoji] = useState("😀");
   const [showEmojiPicker, setShowEmojiPicker] = useState(false);
+  const [password, setPassword] = useState("");
   const { setPlayerInfo } = usePlayerStore();
   const navigate = useNavigate();
 
   const handleSubmit = (e: React.FormEvent) => {
     e.preventDefault();
     if (name.trim()) {
+      setRoomPassword(password);
       setPlayerInfo({ name: name.trim(), emoji: selectedEmoji, id: uuidv4() });
       navigate("/play");
     }
@@ -225,6 +228,24 @@ export function LoginPage() {
             </div>
           </div>
 
+          <div>
+            <label
+              htmlFor="password"
+              className="block text-sm font-medium text-gray-700 mb-2"
+            >
+              Room Password <span className="text-gray-400 font-normal">(private rooms only)</span>
+            </label>
+            <input
+              type="password"
+              id="password"
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              placeholder="Leave empty for public rooms"
+              className="w-full px-4 py-3 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent transition-colors"
+              maxLength={128}
+            />
+          </div>
+
           <button
             type="submit"
             disabled={!name.trim()}
@@ -2,6 +2,9 @@
 import { toast } from "sonner";
 import useActivePlayersStore from "../stores/activePlayersStore";
 import useMessagesStore from "../stores/messagesStore";
+import useGameStore from "../stores/gameStore";
+import useModerationStore from "../stores/moderationStore";
+import useTeamsStore from "../stores/teamsStore";
 import type { Message, ChatMessage } from "../types";
 
 let ws: WebSocket | null = null;
@@ -11,10 +14,37 @@ const maxReconnectAttempts = 5;
 const baseDelay = 1000;
 let isReconnecting = false;
 
+// invite links carry ?invite=<token>; it is kept for the session so reconnects still get in
+const pageParams = new URLSearchParams(window.location.search);
+if (pageParams.get("invite")) {
+  sessionStorage.setItem("invite", pageParams.get("invite")!);
+}
+
+// rooms other than the default one are joined with ?room=<id>
+const roomId = pageParams.get("room");
+
+// the server gives every connection a token for the room's HTTP API, e.g. image uploads
+let roomApi: { roomId: string; token: string } | null = null;
+
+export function getRoomApi() {
+  return roomApi;
+}
+
+export function setRoomPassword(password: string) {
+  sessionStorage.setItem("roomPassword", password);
+}
+
 function getWebSocketUrl(): string {
   const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
   const host = import.meta.env.VITE_WS_HOST || window.location.hostname + ':8080';
-  return `${protocol}//${host}/ws`;
+  const params = new URLSearchParams();
+  if (roomId) params.set("room", roomId);
+  const invite = sessionStorage.getItem("invite");
+  const password = sessionStorage.getItem("roomPassword");
+  if (invite) params.set("invite", invite);
+  if (password) params.set("password", password);
+  const query = params.toString();
+  return `${protocol}//${host}/ws${query ? `?${query}` : ""}`;
 }
 
 function setupWebSocketHandlers() {
@@ -67,6 +97,126 @@ function setupWebSocketHandlers() {
           toast.info(`${leavePayload.playerEmoji} ${leavePayload.playerName} left the game`);
           break;
 
+        case "game_state":
+          useGameStore.getState().setGame(data.payload);
+          break;
+
+        case "word_choices":
+          useGameStore.getState().setWordChoices(data.payload.words);
+          break;
+
+        case "secret_word":
+          useGameStore.getState().setSecretWord(data.payload.word);
+          break;
+
+        case "hint":
+          useGameStore.getState().setHint(data.payload.hint);
+          break;
+
+        case "turn_end":
+          toast.info(`The word was "${data.payload.word}"`);
+          break;
+
+        case "guess_correct":
+          toast.success(`${data.payload.playerEmoji} ${data.payload.playerName} guessed the word! +${data.payload.points}`);
+          break;
+
+        case "guess_close":
+          toast.info(`"${data.payload.guess}" is close!`);
+          break;
+
+        case "prompt":
+          toast.info(`Round ${data.payload.round}: everyone draw "${data.payload.theme}"`);
+          break;
+
+        case "gallery":
+          useGameStore.getState().setGallery(data.payload);
+          break;
+
+        case "prompt_voted":
+          useGameStore.getState().setPromptVote(data.payload.playerId);
+          break;
+
+        case "prompt_results": {
+          useGameStore.getState().setGallery(data.payload);
+          const winners = data.payload.entries.filter((entry) => data.payload.winners.includes(entry.playerId));
+          if (winners.length > 0) {
+            toast.success(`Favourite drawing: ${winners.map((entry) => `${entry.playerEmoji} ${entry.playerName}`).join(", ")}`);
+          } else {
+            toast.info("No votes this round");
+          }
+          break;
+        }
+
+        case "game_over":
+          toast.success("Game over!");
+          break;
+
+        case "game_error":
+          toast.error(data.payload.message);
+          break;
+
+        case "moderation":
+          useModerationStore.getState().setModeration(data.payload);
+          break;
+
+        case "teams":
+          useTeamsStore.getState().setTeams(data.payload);
+          break;
+
+        case "moderation_error":
+          toast.error(data.payload.message);
+          break;
+
+        case "vote":
+          useModerationStore.getState().setVote(data.payload);
+          break;
+
+        case "vote_end": {
+          useModerationStore.getState().setVote(null);
+          const subject = data.payload.type === "kick" ? `kick ${data.payload.targetName}` : "clear the canvas";
+          if (data.payload.passed) {
+            toast.success(`The room voted to ${subject}`);
+          } else {
+            toast.info(`The vote to ${subject} failed`);
+          }
+          break;
+        }
+
+        case "queue":
+          toast.info(`The room is full (${data.payload.maxPlayers} players). You are number ${data.payload.position} in the queue.`, {
+            id: "queue",
+          });
+          break;
+
+        case "join_refused":
+          toast.error(`Could not join: ${data.payload.reason}`);
+          break;
+
+        case "invite": {
+          const room = roomId ? `room=${encodeURIComponent(roomId)}&` : "";
+          const link = `${window.location.origin}/?${room}invite=${data.payload.token}`;
+          navigator.clipboard.writeText(link).then(
+            () => toast.success("Invite link copied to the clipboard"),
+            () => toast.info(`Invite link: ${link}`),
+          );
+          break;
+        }
+
+        case "room_info":
+          if (data.payload.token) {
+            roomApi = { roomId: data.payload.roomId, token: data.payload.token };
+          }
+          break;
+
+        case "kicked":
+          toast.error(`You were removed from the room: ${data.payload.reason}`);
+          break;
+
+        case "room_closed":
+          toast.error(`The room has closed: ${data.payload.reason}`);
+          break;
+
         default:
           console.log("Unknown message type:", data.type);
       }
@@ -0,0 +1,46 @@
+import { create } from "zustand";
+import type { GalleryChallenge, GameState } from "../types";
+
+interface GameStoreState {
+    game: GameState;
+    // the word, only known while this player is drawing
+    secretWord: string | null;
+    // the words offered while this player is choosing
+    wordChoices: string[];
+    // the word with unrevealed letters masked, e.g. "_ _ a _ _"
+    hint: string | null;
+    // the drawings of the prompt round being voted on or just scored
+    gallery: GalleryChallenge | null;
+    // whose drawing this player voted for this round
+    promptVote: string | null;
+    setGame: (game: GameState) => void;
+    setSecretWord: (word: string | null) => void;
+    setWordChoices: (words: string[]) => void;
+    setHint: (hint: string) => void;
+    setGallery: (gallery: GalleryChallenge) => void;
+    setPromptVote: (playerId: string) => void;
+}
+
+const useGameStore = create<GameStoreState>((set) => ({
+    game: { phase: "idle", round: 0, totalRounds: 0, scores: {} },
+    secretWord: null,
+    wordChoices: [],
+    hint: null,
+    gallery: null,
+    promptVote: null,
+    setGame: (game) => set((state) => ({
+        game,
+        hint: game.phase === "drawing" ? state.hint ?? game.hint ?? null : null,
+        secretWord: game.phase === "drawing" ? state.secretWord : null,
+        wordChoices: game.phase === "choosing" ? state.wordChoices : [],
+        gallery: game.phase === "prompt_voting" || game.phase === "prompt_results" ? state.gallery : null,
+        promptVote: game.phase === "prompt_voting" || game.phase === "prompt_results" ? state.promptVote : null,
+    })),
+    setSecretWord: (word) => set({ secretWord: word }),
+    setWordChoices: (words) => set({ wordChoices: words }),
+    setHint: (hint) => set({ hint }),
+    setGallery: (gallery) => set({ gallery }),
+    setPromptVote: (playerId) => set({ promptVote: playerId }),
+}));
+
+export default useGameStore;
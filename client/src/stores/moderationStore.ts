@@ -0,0 +1,26 @@
+import { create } from "zustand";
+import type { ModerationState, VoteState } from "../types";
+
+interface ModerationStoreState {
+    moderation: ModerationState;
+    // the vote-kick or vote-clear currently open, if any
+    vote: VoteState | null;
+    setModeration: (moderation: ModerationState) => void;
+    setVote: (vote: VoteState | null) => void;
+}
+
+const useModerationStore = create<ModerationStoreState>((set) => ({
+    moderation: {
+        hostId: "",
+        hostOnlyClear: false,
+        muted: [],
+        drawingLockedTo: [],
+        passwordProtected: false,
+        inviteOnly: false,
+    },
+    vote: null,
+    setModeration: (moderation) => set({ moderation }),
+    setVote: (vote) => set({ vote }),
+}));
+
+export default useModerationStore;
@@ -0,0 +1,14 @@
+import { create } from "zustand";
+import type { TeamState } from "../types";
+
+interface TeamsStoreState extends TeamState {
+    setTeams: (state: TeamState) => void;
+}
+
+const useTeamsStore = create<TeamsStoreState>((set) => ({
+    teams: [],
+    members: {},
+    setTeams: ({ teams, members }) => set({ teams, members }),
+}));
+
+export default useTeamsStore;
@@ -14,6 +14,7 @@ export type Message = {
         id: string;
         playerName: string;
         playerEmoji: string;
+        team?: string;
     }
 } | {
     type: "player_leave";
@@ -48,12 +49,325 @@ export type Message = {
         playerName: string;
         playerEmoji: string;
     }
+} | {
+    type: "canvas_sync";
+    payload: CanvasDocument
+} | {
+    type: "fill";
+    payload: {
+        id: string;
+        playerName: string;
+        playerEmoji: string;
+        x: number;
+        y: number;
+        color: string;
+        spans: number[];
+    }
+} | {
+    type: "image_place";
+    payload: {
+        id: string;
+        playerName: string;
+        playerEmoji: string;
+        imageId: string;
+        x: number;
+        y: number;
+        scale: number;
+        rotation: number;
+    }
+} | {
+    type: "cursor";
+    payload: {
+        id: string;
+        playerName: string;
+        playerEmoji: string;
+        x: number;
+        y: number;
+    }
+} | {
+    type: "game_start";
+    payload: {
+        mode?: "pictionary" | "prompt";
+        rounds?: number;
+        turnSeconds?: number;
+        packs?: string[];
+        theme?: string;
+    }
+} | {
+    type: "word_choices";
+    payload: {
+        words: string[];
+    }
+} | {
+    type: "choose_word";
+    payload: {
+        word: string;
+    }
+} | {
+    type: "game_state";
+    payload: GameState
+} | {
+    type: "secret_word";
+    payload: {
+        word: string;
+    }
+} | {
+    type: "hint";
+    payload: {
+        hint: string;
+    }
+} | {
+    type: "turn_end";
+    payload: {
+        drawerId: string;
+        word: string;
+        reason: "time_up" | "drawer_left" | "all_guessed";
+    }
+} | {
+    type: "guess_correct";
+    payload: {
+        id: string;
+        playerName: string;
+        playerEmoji: string;
+        points: number;
+        drawerId: string;
+        drawerPoints: number;
+    }
+} | {
+    type: "guess_close";
+    payload: {
+        guess: string;
+    }
+} | {
+    type: "game_over";
+    payload: {
+        reason: string;
+        word: string;
+        scores: Record<string, number>;
+        teamScores?: Record<string, number>;
+    }
+} | {
+    type: "prompt";
+    payload: {
+        theme: string;
+        round: number;
+    }
+} | {
+    type: "gallery" | "prompt_results";
+    payload: GalleryChallenge
+} | {
+    type: "prompt_vote" | "prompt_voted";
+    payload: {
+        playerId: string;
+    }
+} | {
+    type: "game_error";
+    payload: {
+        message: string;
+    }
+} | {
+    type: "kick" | "ban" | "mute" | "unmute" | "transfer_host";
+    payload: {
+        playerId: string;
+    }
+} | {
+    type: "assign_team";
+    payload: {
+        playerId: string;
+        team: string;
+    }
+} | {
+    type: "teams";
+    payload: TeamState
+} | {
+    type: "lock_drawing";
+    payload: {
+        playerIds: string[];
+    }
+} | {
+    type: "host_only_clear";
+    payload: {
+        enabled: boolean;
+    }
+} | {
+    type: "vote_kick";
+    payload: {
+        playerId: string;
+    }
+} | {
+    type: "vote_clear";
+    payload: Record<string, never>;
+} | {
+    type: "vote";
+    payload: VoteState
+} | {
+    type: "vote_end";
+    payload: {
+        type: "kick" | "clear";
+        targetId: string;
+        targetName: string;
+        passed: boolean;
+        reason: "passed" | "expired" | "target_left";
+    }
+} | {
+    type: "set_password";
+    payload: {
+        password: string;
+    }
+} | {
+    type: "invite_only";
+    payload: {
+        enabled: boolean;
+    }
+} | {
+    type: "create_invite";
+    payload: {
+        minutes?: number;
+        maxUses?: number;
+    }
+} | {
+    type: "invite";
+    payload: {
+        token: string;
+        expiresAt: string;
+        maxUses?: number;
+    }
+} | {
+    type: "end_game";
+    payload: Record<string, never>;
+} | {
+    type: "moderation";
+    payload: ModerationState
+} | {
+    type: "moderation_error";
+    payload: {
+        message: string;
+    }
+} | {
+    type: "kicked";
+    payload: {
+        reason: string;
+    }
+} | {
+    type: "room_closed";
+    payload: {
+        reason: string;
+    }
+} | {
+    type: "queue";
+    payload: {
+        position: number;
+        length: number;
+        maxPlayers: number;
+    }
+} | {
+    type: "join_refused";
+    payload: {
+        reason: string;
+    }
+} | {
+    type: "room_info";
+    payload: {
+        roomId: string;
+        name: string;
+        canvasWidth: number;
+        canvasHeight: number;
+        background: string;
+        // only sent to the player they belong to
+        token?: string;
+        statsId?: string;
+    }
 };
 
+export interface GameState {
+    phase: "idle" | "choosing" | "drawing" | "turn_end" | "prompt_drawing" | "prompt_voting" | "prompt_results";
+    mode?: "pictionary" | "prompt";
+    theme?: string;
+    round: number;
+    totalRounds: number;
+    drawerId?: string;
+    drawerName?: string;
+    drawerEmoji?: string;
+    wordLength?: number;
+    hint?: string;
+    guessed?: string[];
+    phaseEndsAt?: string;
+    scores: Record<string, number>;
+    teamScores?: Record<string, number>;
+}
+
+export interface GalleryEntry {
+    playerId: string;
+    playerName: string;
+    playerEmoji: string;
+    votes: number;
+    imageUrl: string;
+}
+
+export interface GalleryChallenge {
+    id: string;
+    theme: string;
+    createdAt: string;
+    width: number;
+    height: number;
+    background: string;
+    imageUrl: string;
+    entries: GalleryEntry[];
+    // empty until the votes are in
+    winners: string[];
+}
+
+export interface TeamState {
+    // empty when the room doesn't play in teams
+    teams: string[];
+    members: Record<string, string>;
+}
+
+export interface ModerationState {
+    hostId: string;
+    hostOnlyClear: boolean;
+    muted: string[];
+    drawingLockedTo: string[];
+    passwordProtected: boolean;
+    inviteOnly: boolean;
+}
+
+export interface VoteState {
+    type: "kick" | "clear";
+    targetId?: string;
+    targetName?: string;
+    startedBy: string;
+    votes: number;
+    needed: number;
+    endsAt: string;
+}
+
+export interface CanvasOp {
+    type: "path" | "fill" | "image";
+    playerId: string;
+    points?: { x: number; y: number }[];
+    color?: string;
+    strokeWidth?: number;
+    spans?: number[];
+    imageId?: string;
+    scale?: number;
+    rotation?: number;
+    timestamp: string;
+}
+
+export interface CanvasDocument {
+    width: number;
+    height: number;
+    background?: string;
+    ops: CanvasOp[];
+}
+
 export interface ChatMessage {
     id: string;
     playerName: string;
     playerEmoji: string;
     message: string;
     timestamp: Date;
+    // team chat only reaches the sender's team
+    team?: boolean;
 }
\ No newline at end of file
@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MinPasswordLength = 4
+	MaxPasswordLength = 128
+
+	DefaultInviteDuration = 24 * time.Hour
+	MaxInviteDuration     = 30 * 24 * time.Hour
+	MaxInviteUses         = 1000
+
+	passwordIterations = 100_000
+)
+
+var (
+	ErrPasswordRequired = errors.New("this room is private, a password or invite is required")
+	ErrInviteRequired   = errors.New("this room is invite-only")
+	ErrWrongPassword    = errors.New("wrong password")
+	ErrInvalidInvite    = errors.New("invalid invite")
+	ErrInviteExpired    = errors.New("the invite has expired")
+	ErrInviteUsedUp     = errors.New("the invite has been used up")
+)
+
+// InviteSecret signs invite tokens. Tokens stay valid across restarts only if it is set from configuration.
+var InviteSecret = randomBytes(32)
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// Invite is what an invite token carries; the signature makes it impossible to forge or alter
+type Invite struct {
+	Id        string    `json:"id"`
+	RoomId    string    `json:"roomId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxUses limits how many different browsers can join with the invite; zero means no limit
+	MaxUses int `json:"maxUses,omitempty"`
+}
+
+func signInvite(payload []byte) []byte {
+	mac := hmac.New(sha256.New, InviteSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Token encodes the invite as "<payload>.<signature>", both base64url
+func (i Invite) Token() string {
+	payload, _ := json.Marshal(i)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signInvite(payload))
+}
+
+// ParseInvite checks an invite token's signature and decodes it; it doesn't check expiry or uses
+func ParseInvite(token string) (Invite, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Invite{}, ErrInvalidInvite
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return Invite{}, ErrInvalidInvite
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, signInvite(payload)) {
+		return Invite{}, ErrInvalidInvite
+	}
+	var invite Invite
+	if err := json.Unmarshal(payload, &invite); err != nil {
+		return Invite{}, ErrInvalidInvite
+	}
+	return invite, nil
+}
+
+// RoomAccess decides who may connect to a room. A room is private once it has a password or is invite-only;
+// either the password or a valid invite gets a player in.
+type RoomAccess struct {
+	mu           sync.Mutex
+	passwordSalt []byte
+	passwordHash []byte
+	inviteOnly   bool
+	// inviteUses records which identities have used each invite, so reconnecting doesn't use it up
+	inviteUses map[string]map[string]bool
+}
+
+func NewRoomAccess() *RoomAccess {
+	return &RoomAccess{
+		inviteUses: make(map[string]map[string]bool),
+	}
+}
+
+func hashPassword(password string, salt []byte) []byte {
+	hash, _ := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	return hash
+}
+
+// SetPassword protects the room with a password, or removes the password when it is empty
+func (a *RoomAccess) SetPassword(password string) error {
+	if password != "" && (len(password) < MinPasswordLength || len(password) > MaxPasswordLength) {
+		return fmt.Errorf("passwords must be between %d and %d characters", MinPasswordLength, MaxPasswordLength)
+	}
+	var salt, hash []byte
+	if password != "" {
+		salt = randomBytes(16)
+		hash = hashPassword(password, salt)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.passwordSalt, a.passwordHash = salt, hash
+	return nil
+}
+
+func (a *RoomAccess) SetInviteOnly(inviteOnly bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inviteOnly = inviteOnly
+}
+
+func (a *RoomAccess) HasPassword() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.passwordHash != nil
+}
+
+func (a *RoomAccess) InviteOnly() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.inviteOnly
+}
+
+func (a *RoomAccess) Private() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.passwordHash != nil || a.inviteOnly
+}
+
+// Check lets a connection into the room with roomId if it is public, the password is right or the invite is valid.
+// A valid invite counts as used by the identity.
+func (a *RoomAccess) Check(roomId string, identity string, password string, token string, now time.Time) error {
+	a.mu.Lock()
+	salt, hash := a.passwordSalt, a.passwordHash
+	private := hash != nil || a.inviteOnly
+	a.mu.Unlock()
+
+	if !private {
+		return nil
+	}
+	if token != "" {
+		return a.useInvite(roomId, identity, token, now)
+	}
+	if hash == nil {
+		return ErrInviteRequired
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	// the password is hashed outside the lock, as it is slow on purpose
+	if subtle.ConstantTimeCompare(hashPassword(password, salt), hash) != 1 {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+func (a *RoomAccess) useInvite(roomId string, identity string, token string, now time.Time) error {
+	invite, err := ParseInvite(token)
+	if err != nil || invite.RoomId != roomId {
+		return ErrInvalidInvite
+	}
+	if !now.Before(invite.ExpiresAt) {
+		return ErrInviteExpired
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	uses := a.inviteUses[invite.Id]
+	if uses[identity] {
+		return nil
+	}
+	if invite.MaxUses > 0 && len(uses) >= invite.MaxUses {
+		return ErrInviteUsedUp
+	}
+	if uses == nil {
+		uses = make(map[string]bool)
+		a.inviteUses[invite.Id] = uses
+	}
+	uses[identity] = true
+	return nil
+}
+
+// NewInvite makes an invite to the room that lasts for duration and can be used maxUses times (zero for no limit)
+func NewInvite(roomId string, duration time.Duration, maxUses int) (Invite, error) {
+	if duration < time.Minute || duration > MaxInviteDuration {
+		return Invite{}, fmt.Errorf("invites must last between a minute and %d days", MaxInviteDuration/(24*time.Hour))
+	}
+	if maxUses < 0 || maxUses > MaxInviteUses {
+		return Invite{}, fmt.Errorf("an invite can be used at most %d times", MaxInviteUses)
+	}
+	return Invite{
+		Id:        randomHex(8),
+		RoomId:    roomId,
+		ExpiresAt: time.Now().Add(duration).UTC().Truncate(time.Second),
+		MaxUses:   maxUses,
+	}, nil
+}
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// IdentityCookie holds the identity the server issues to every browser on its first connection.
+	// Unlike player ids, which the client makes up, it can't be changed just by reloading the page.
+	IdentityCookie       = "polydraw_identity"
+	IdentityCookieMaxAge = 365 * 24 * time.Hour
+
+	// HostBanDuration is how long a ban issued by a room host lasts
+	HostBanDuration = 24 * time.Hour
+)
+
+var identityPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+var ErrBanNotFound = errors.New("ban not found")
+
+// Bans holds the ban list; it is nil until InitBans is called, in which case nobody is banned
+var Bans *BanList
+
+// AdminToken guards the admin API; the API is disabled while it is empty
+var AdminToken string
+
+// Ban keeps an identity, an IP address or both out of one room, or out of every room when RoomId is empty
+type Ban struct {
+	Id        string    `json:"id"`
+	Identity  string    `json:"identity,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	RoomId    string    `json:"roomId,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is zero for a ban that lasts until it is lifted
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+func (b *Ban) expired(now time.Time) bool {
+	return !b.ExpiresAt.IsZero() && !now.Before(b.ExpiresAt)
+}
+
+func (b *Ban) matches(identity string, ip string, roomId string) bool {
+	if b.RoomId != "" && b.RoomId != roomId {
+		return false
+	}
+	return (b.Identity != "" && b.Identity == identity) || (b.IP != "" && b.IP == ip)
+}
+
+// BanList keeps every ban in memory and writes each change straight to the embedded KV store
+type BanList struct {
+	mu   sync.RWMutex
+	kv   *KV
+	bans map[string]*Ban
+}
+
+func banKey(banId string) string {
+	return "bans/" + banId
+}
+
+// NewIdentity makes a random identity for a browser that doesn't have one yet
+func NewIdentity() string {
+	return randomHex(16)
+}
+
+// ValidIdentity reports whether a cookie value could have come from NewIdentity
+func ValidIdentity(identity string) bool {
+	return identityPattern.MatchString(identity)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InitBans opens the shared ban list at path
+func InitBans(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	kv, err := OpenKV(path)
+	if err != nil {
+		return err
+	}
+
+	list := &BanList{
+		kv:   kv,
+		bans: make(map[string]*Ban),
+	}
+	for _, key := range kv.Keys("bans/") {
+		data, _ := kv.Get(key)
+		var ban Ban
+		if err := json.Unmarshal(data, &ban); err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		list.bans[ban.Id] = &ban
+	}
+
+	LogInfo("Loaded %d bans", len(list.bans))
+	Bans = list
+	return nil
+}
+
+// Add records a new ban, filling in its id and creation time
+func (l *BanList) Add(ban Ban) (Ban, error) {
+	if ban.Identity == "" && ban.IP == "" {
+		return Ban{}, errors.New("a ban needs an identity or an IP address")
+	}
+	if ban.Identity != "" && !ValidIdentity(ban.Identity) {
+		return Ban{}, errors.New("invalid identity")
+	}
+	if ban.IP != "" {
+		addr, err := netip.ParseAddr(ban.IP)
+		if err != nil {
+			return Ban{}, errors.New("invalid IP address")
+		}
+		ban.IP = addr.Unmap().String()
+	}
+
+	ban.Id = randomHex(8)
+	ban.CreatedAt = time.Now()
+	if ban.expired(ban.CreatedAt) {
+		return Ban{}, errors.New("the ban would already have expired")
+	}
+	data, err := json.Marshal(ban)
+	if err != nil {
+		return Ban{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.kv.Put(banKey(ban.Id), data); err != nil {
+		return Ban{}, err
+	}
+	if err := l.kv.Sync(); err != nil {
+		return Ban{}, err
+	}
+	l.bans[ban.Id] = &ban
+	l.pruneLocked(ban.CreatedAt)
+	return ban, nil
+}
+
+// Remove lifts a ban
+func (l *BanList) Remove(banId string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.bans[banId]; !ok {
+		return ErrBanNotFound
+	}
+	if err := l.kv.Delete(banKey(banId)); err != nil {
+		return err
+	}
+	delete(l.bans, banId)
+	return l.kv.Sync()
+}
+
+// pruneLocked forgets bans that have run out; l.mu must be held
+func (l *BanList) pruneLocked(now time.Time) {
+	for id, ban := range l.bans {
+		if ban.expired(now) {
+			if err := l.kv.Delete(banKey(id)); err != nil {
+				LogError("Error deleting expired ban %s: %v", id, err)
+				continue
+			}
+			delete(l.bans, id)
+		}
+	}
+}
+
+// List returns the bans in force, oldest first
+func (l *BanList) List() []Ban {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	bans := make([]Ban, 0, len(l.bans))
+	for _, ban := range l.bans {
+		if !ban.expired(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	slices.SortFunc(bans, func(a, b Ban) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return bans
+}
+
+// Check looks for a ban in force against the identity or IP address in the given room
+func (l *BanList) Check(identity string, ip string, roomId string) (Ban, bool) {
+	if l == nil {
+		return Ban{}, false
+	}
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, ban := range l.bans {
+		if !ban.expired(now) && ban.matches(identity, ip, roomId) {
+			return *ban, true
+		}
+	}
+	return Ban{}, false
+}
+
+func (l *BanList) Close() error {
+	return l.kv.Close()
+}
+
+// EnforceBans asks the hub to drop every connection that a ban now applies to
+func (h *Hub) EnforceBans() {
+	deliver(h, h.Moderate, ModerationCommand{Type: "enforce_bans"})
+}
+
+// enforceBans runs on the hub goroutine
+func (h *Hub) enforceBans() {
+	for _, player := range h.Players {
+		ban, banned := Bans.Check(player.Identity, player.IP, h.Id)
+		if !banned {
+			continue
+		}
+		LogInfo("Removing banned player %s from room %s: %s", player.PlayerName, h.Id, ban.Reason)
+		h.sendEvent(player, "kicked", map[string]any{"reason": "banned: " + ban.Reason})
+		h.removePlayer(player)
+	}
+}
@@ -0,0 +1,284 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCanvasWidth      = 600
+	DefaultCanvasHeight     = 600
+	DefaultCanvasBackground = "#ffffff"
+
+	// every stroke is redrawn on each render, fill and time-lapse frame, so a single path is kept within these
+	MaxStrokeWidth = 64
+	MaxPathPoints  = 1000
+)
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// CanvasOp is a single operation recorded in the canvas history.
+// A "path" is a stroke through Points; a "fill" is seeded at Points[0] and covers the row Spans (y, x0, x1
+// triples) that the server computed when it was applied; an "image" places uploaded image ImageId centred on
+// Points[0], scaled by Scale and rotated clockwise by Rotation degrees.
+type CanvasOp struct {
+	Type        string    `json:"type"`
+	PlayerId    string    `json:"playerId"`
+	Points      []Point   `json:"points,omitempty"`
+	Color       string    `json:"color,omitempty"`
+	StrokeWidth float64   `json:"strokeWidth,omitempty"`
+	Spans       []int     `json:"spans,omitempty"`
+	ImageId     string    `json:"imageId,omitempty"`
+	Scale       float64   `json:"scale,omitempty"`
+	Rotation    float64   `json:"rotation,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Canvas holds the server-side drawing history of a room
+type Canvas struct {
+	mu         sync.RWMutex
+	Width      int
+	Height     int
+	Background string
+	ops        []CanvasOp
+	// raster is the history drawn so far, kept up to date by every append so a fill doesn't redraw every stroke.
+	// It is only built once the first fill needs it and dropped whenever the history is replaced.
+	raster *image.RGBA
+
+	// persistence, unset when the canvas only lives in memory
+	roomId string
+	store  CanvasStore
+	dirty  bool
+}
+
+func NewCanvas(width int, height int, background string) *Canvas {
+	return &Canvas{
+		Width:      width,
+		Height:     height,
+		Background: background,
+		ops:        []CanvasOp{},
+	}
+}
+
+// Clamp moves points that fall outside the canvas onto its nearest edge
+func (c *Canvas) Clamp(points []Point) []Point {
+	clamped := make([]Point, len(points))
+	for i, p := range points {
+		clamped[i] = Point{
+			X: min(max(p.X, 0), float64(c.Width)),
+			Y: min(max(p.Y, 0), float64(c.Height)),
+		}
+	}
+	return clamped
+}
+
+// ClampStroke keeps a path within MaxPathPoints and its width between 1 and MaxStrokeWidth
+func ClampStroke(points []Point, strokeWidth float64) ([]Point, float64) {
+	if len(points) > MaxPathPoints {
+		points = points[:MaxPathPoints]
+	}
+	if math.IsNaN(strokeWidth) {
+		strokeWidth = 1
+	}
+	return points, min(max(strokeWidth, 1), MaxStrokeWidth)
+}
+
+// Append records an operation at the end of the history
+func (c *Canvas) Append(op CanvasOp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.appendLocked(op)
+}
+
+func (c *Canvas) appendLocked(op CanvasOp) {
+	c.ops = append(c.ops, op)
+	if c.raster != nil {
+		drawOp(c.raster, op, 1)
+	}
+
+	if c.store != nil {
+		if err := c.store.Append(c.roomId, op); err != nil {
+			LogError("Error persisting canvas op for room %s: %v", c.roomId, err)
+		}
+		c.dirty = true
+	}
+}
+
+// Fill flood fills the region around the point as the canvas currently looks and records the result.
+// The region is worked out here, once, so exports and every client paint exactly the same pixels.
+// It returns false when there is nothing to fill.
+func (c *Canvas) Fill(playerId string, x float64, y float64, color string) (CanvasOp, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.raster == nil {
+		c.raster = RenderOps(c.ops, c.Width, c.Height, c.Background)
+	}
+	img := c.raster
+	seedX, seedY := int(math.Floor(x)), int(math.Floor(y))
+	if !(image.Point{X: seedX, Y: seedY}).In(img.Bounds()) {
+		return CanvasOp{}, false
+	}
+	if img.RGBAAt(seedX, seedY) == toRGBA(parseColor(color)) {
+		return CanvasOp{}, false
+	}
+
+	op := CanvasOp{
+		Type:      "fill",
+		PlayerId:  playerId,
+		Points:    []Point{{X: x, Y: y}},
+		Color:     color,
+		Spans:     FloodFill(img, seedX, seedY),
+		Timestamp: time.Now(),
+	}
+	c.appendLocked(op)
+	return op, true
+}
+
+// Clear drops the whole history
+func (c *Canvas) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = []CanvasOp{}
+	c.raster = nil
+	c.snapshotLocked()
+}
+
+// Ops returns a copy of the history that is safe to read without holding the lock
+func (c *Canvas) Ops() []CanvasOp {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ops := make([]CanvasOp, len(c.ops))
+	copy(ops, c.ops)
+	return ops
+}
+
+// CanvasDocument is the JSON export format of a canvas, also used to import one back
+type CanvasDocument struct {
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	Background string     `json:"background,omitempty"`
+	Ops        []CanvasOp `json:"ops"`
+}
+
+// Document returns a snapshot of the canvas in its export format
+func (c *Canvas) Document() CanvasDocument {
+	return CanvasDocument{
+		Width:      c.Width,
+		Height:     c.Height,
+		Background: c.Background,
+		Ops:        c.Ops(),
+	}
+}
+
+// Replace swaps the whole history for the given operations
+func (c *Canvas) Replace(ops []CanvasOp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = make([]CanvasOp, len(ops))
+	copy(c.ops, ops)
+	c.raster = nil
+	c.snapshotLocked()
+}
+
+// Validate checks an imported document against the canvas it is going to be loaded into
+func (d CanvasDocument) Validate(canvas *Canvas) error {
+	if d.Width != canvas.Width || d.Height != canvas.Height {
+		return fmt.Errorf("canvas size %dx%d does not match room canvas %dx%d", d.Width, d.Height, canvas.Width, canvas.Height)
+	}
+	for i, op := range d.Ops {
+		switch op.Type {
+		case "path":
+			if len(op.Points) == 0 || len(op.Points) > MaxPathPoints {
+				return fmt.Errorf("op %d: a path needs between 1 and %d points", i, MaxPathPoints)
+			}
+			if op.StrokeWidth > MaxStrokeWidth {
+				return fmt.Errorf("op %d: stroke width can be at most %d", i, MaxStrokeWidth)
+			}
+		case "fill":
+			if len(op.Points) != 1 || len(op.Spans)%3 != 0 {
+				return fmt.Errorf("op %d: fill needs one seed point and y, x0, x1 span triples", i)
+			}
+			for j := 0; j < len(op.Spans); j += 3 {
+				y, x0, x1 := op.Spans[j], op.Spans[j+1], op.Spans[j+2]
+				if y < 0 || y >= canvas.Height || x0 < 0 || x1 > canvas.Width || x0 >= x1 {
+					return fmt.Errorf("op %d: fill span %d is outside the canvas", i, j/3)
+				}
+			}
+		case "image":
+			if len(op.Points) != 1 || op.Scale <= 0 || op.Scale > MaxImageScale {
+				return fmt.Errorf("op %d: image needs one centre point and a scale up to %d", i, MaxImageScale)
+			}
+			if Images == nil || !Images.Exists(op.ImageId) {
+				return fmt.Errorf("op %d: image %q has not been uploaded", i, op.ImageId)
+			}
+		default:
+			return fmt.Errorf("op %d: unknown type %q", i, op.Type)
+		}
+	}
+	return nil
+}
+
+// Persist restores any history saved for the room and records every later change to the store
+func (c *Canvas) Persist(roomId string, store CanvasStore) error {
+	ops, err := store.Load(roomId)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ops = append([]CanvasOp{}, ops...)
+	c.raster = nil
+	c.roomId = roomId
+	c.store = store
+	c.dirty = false
+	return nil
+}
+
+// Snapshot writes the full history to the store, which compacts its log, if anything changed since the last one
+func (c *Canvas) Snapshot() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dirty {
+		c.snapshotLocked()
+	}
+}
+
+func (c *Canvas) snapshotLocked() {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.Snapshot(c.roomId, c.ops); err != nil {
+		LogError("Error writing canvas snapshot for room %s: %v", c.roomId, err)
+		return
+	}
+	c.dirty = false
+}
+
+// RunSnapshots takes a snapshot every interval until stop is closed, then takes a final one
+func (c *Canvas) RunSnapshots(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Snapshot()
+		case <-stop:
+			c.Snapshot()
+			return
+		}
+	}
+}
+
+// toRGBA converts to the premultiplied form stored in an RGBA image
+func toRGBA(c color.Color) color.RGBA {
+	return color.RGBAModel.Convert(c).(color.RGBA)
+}
@@ -0,0 +1,167 @@
+package internal
+
+import "slices"
+
+// SeatRequest asks the hub to let a connection join the room under the given name
+type SeatRequest struct {
+	Player      *Player
+	Id          string
+	PlayerName  string
+	PlayerEmoji string
+}
+
+// RequestSeat passes a join to the hub, which seats the player, queues them or refuses them when the room is full.
+// Everything that follows, from the player's details to telling everyone they joined, happens on the hub goroutine.
+func (h *Hub) RequestSeat(player *Player, id string, playerName string, playerEmoji string) {
+	if id == "" || playerName == "" || playerEmoji == "" {
+		return
+	}
+	deliver(h, h.Seats, SeatRequest{Player: player, Id: id, PlayerName: playerName, PlayerEmoji: playerEmoji})
+}
+
+// hasFreeSeat reports whether another player fits in the room; a MaxPlayers of zero means no limit
+func (h *Hub) hasFreeSeat() bool {
+	return h.Settings.MaxPlayers == 0 || len(h.joinedPlayerIds()) < h.Settings.MaxPlayers
+}
+
+func (h *Hub) handleSeatRequest(request SeatRequest) {
+	// the player may have disconnected while the request was queued
+	if _, ok := h.Players[request.Player.Conn]; !ok {
+		return
+	}
+
+	if reason := h.joinConflict(request); reason != "" {
+		LogWarning("Refusing join of %s as %s in room %s: %s", request.PlayerName, request.Id, h.Id, reason)
+		IncrementPlayerRefused()
+		h.sendEvent(request.Player, "join_refused", map[string]any{"reason": reason})
+		return
+	}
+
+	// a player who already has a seat, e.g. from another tab, doesn't need a second one
+	if h.playerById(request.Id) != nil || (len(h.queue) == 0 && h.hasFreeSeat()) {
+		h.seat(request)
+		return
+	}
+
+	if len(h.queue) < h.Settings.QueueSize {
+		LogInfo("Room %s is full, %s is waiting in the queue", h.Id, request.PlayerName)
+		h.queue = append(h.queue, request)
+		SetQueuedPlayersCount(h.Id, float64(len(h.queue)))
+		h.sendQueuePositions()
+		return
+	}
+
+	LogInfo("Room %s is full, refusing %s", h.Id, request.PlayerName)
+	IncrementPlayerRefused()
+	h.sendEvent(request.Player, "join_refused", map[string]any{"reason": "the room is full"})
+	h.removePlayer(request.Player)
+}
+
+// joinConflict explains why the request can't be let in, or returns "" if it can. A connection joins only once,
+// and a player id always belongs to one browser identity: the same player in a second tab shares their seat, but
+// nobody else can take over their id, and one browser can't hold two seats under different ids.
+func (h *Hub) joinConflict(request SeatRequest) string {
+	if request.Player.Id != "" {
+		return "you have already joined"
+	}
+
+	conflict := func(id string, identity string) string {
+		if id == request.Id && identity != request.Player.Identity {
+			return "that player id is already taken"
+		}
+		if identity == request.Player.Identity && id != request.Id {
+			return "you are already in this room under another name"
+		}
+		return ""
+	}
+	for _, player := range h.Players {
+		if player.Id == "" {
+			continue
+		}
+		if reason := conflict(player.Id, player.Identity); reason != "" {
+			return reason
+		}
+	}
+	for _, queued := range h.queue {
+		if queued.Player == request.Player {
+			return "you have already joined"
+		}
+		if reason := conflict(queued.Id, queued.Player.Identity); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// seat lets the player in; from here on they count as joined. The player is told about the room and brought up
+// to date with what has already been drawn, and everyone else hears that they joined.
+func (h *Hub) seat(request SeatRequest) {
+	player := request.Player
+	player.Id = request.Id
+	player.PlayerName = request.PlayerName
+	player.PlayerEmoji = request.PlayerEmoji
+	player.seated = true
+	LogInfo("Player joined with id %s, name: %s, emoji: %s", player.Id, player.PlayerName, player.PlayerEmoji)
+	IncrementPlayerJoined()
+	if h.Settings.Teams > 0 {
+		h.assignTeam(player)
+		h.broadcastEvent("teams", h.teamState())
+	}
+	SetActivePlayersCount(h.Id, float64(len(h.GetActivePlayers())))
+
+	h.broadcastPlayerJoin(player)
+	// the first player in the room becomes its host
+	h.playerArrived(player)
+	h.sendEvent(player, "room_info", h.playerRoomInfo(player))
+	syncEventBytes, err := h.canvasSyncEvent()
+	if err != nil {
+		LogError("Error marshaling canvas sync event: %v", err)
+	} else {
+		h.send(player, syncEventBytes)
+	}
+	h.sendEvent(player, "game_state", h.Game.State())
+}
+
+// sendQueuePositions tells every waiting player where they are in the queue
+func (h *Hub) sendQueuePositions() {
+	for i, request := range h.queue {
+		h.sendEvent(request.Player, "queue", map[string]any{
+			"position":   i + 1,
+			"length":     len(h.queue),
+			"maxPlayers": h.Settings.MaxPlayers,
+		})
+	}
+}
+
+// admitQueued seats waiting players, in order, while there is room
+func (h *Hub) admitQueued() {
+	if len(h.queue) == 0 || !h.hasFreeSeat() {
+		return
+	}
+	for len(h.queue) > 0 && h.hasFreeSeat() {
+		request := h.queue[0]
+		h.queue = h.queue[1:]
+		// someone may have joined under the same id while the request waited
+		if reason := h.joinConflict(request); reason != "" {
+			h.sendEvent(request.Player, "join_refused", map[string]any{"reason": reason})
+			continue
+		}
+		LogInfo("A seat freed up in room %s, admitting %s", h.Id, request.PlayerName)
+		h.seat(request)
+	}
+	SetQueuedPlayersCount(h.Id, float64(len(h.queue)))
+	h.sendQueuePositions()
+}
+
+// leaveQueue drops a connection that gave up waiting
+func (h *Hub) leaveQueue(player *Player) {
+	i := slices.IndexFunc(h.queue, func(request SeatRequest) bool {
+		return request.Player == player
+	})
+	if i < 0 {
+		return
+	}
+	h.queue = slices.Delete(h.queue, i, i+1)
+	SetQueuedPlayersCount(h.Id, float64(len(h.queue)))
+	h.sendQueuePositions()
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// fillTolerance is how far, per channel, a pixel may differ from the seed colour and still be filled.
+// It lets a fill swallow the antialiased edge of the strokes around it instead of leaving a halo.
+const fillTolerance = 48
+
+// FloodFill returns the 4-connected region around (x, y) whose colour is within fillTolerance of the seed pixel.
+// The region is a list of row spans flattened into y, x0, x1 triples (x1 exclusive), sorted by row then column,
+// so the same image and seed always produce the same spans.
+func FloodFill(img *image.RGBA, x int, y int) []int {
+	bounds := img.Bounds()
+	if !(image.Point{X: x, Y: y}).In(bounds) {
+		return nil
+	}
+
+	seed := img.RGBAAt(x, y)
+	width := bounds.Dx()
+	visited := make([]bool, width*bounds.Dy())
+	matches := func(px int, py int) bool {
+		if visited[(py-bounds.Min.Y)*width+(px-bounds.Min.X)] {
+			return false
+		}
+		return colorWithin(img.RGBAAt(px, py), seed, fillTolerance)
+	}
+
+	var spans []int
+	stack := []image.Point{{X: x, Y: y}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !matches(p.X, p.Y) {
+			continue
+		}
+
+		// grow the span left and right from the popped point
+		x0, x1 := p.X, p.X+1
+		for x0 > bounds.Min.X && matches(x0-1, p.Y) {
+			x0--
+		}
+		for x1 < bounds.Max.X && matches(x1, p.Y) {
+			x1++
+		}
+		rowStart := (p.Y - bounds.Min.Y) * width
+		for i := x0; i < x1; i++ {
+			visited[rowStart+i-bounds.Min.X] = true
+		}
+		spans = append(spans, p.Y, x0, x1)
+
+		// queue the start of every matching run directly above and below
+		for _, ny := range []int{p.Y - 1, p.Y + 1} {
+			if ny < bounds.Min.Y || ny >= bounds.Max.Y {
+				continue
+			}
+			inRun := false
+			for i := x0; i < x1; i++ {
+				if matches(i, ny) {
+					if !inRun {
+						stack = append(stack, image.Point{X: i, Y: ny})
+						inRun = true
+					}
+				} else {
+					inRun = false
+				}
+			}
+		}
+	}
+
+	sortSpans(spans)
+	return spans
+}
+
+func colorWithin(a color.RGBA, b color.RGBA, tolerance int) bool {
+	diff := func(x uint8, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return diff(a.R, b.R) <= tolerance && diff(a.G, b.G) <= tolerance && diff(a.B, b.B) <= tolerance && diff(a.A, b.A) <= tolerance
+}
+
+type spanTriples []int
+
+func (s spanTriples) Len() int { return len(s) / 3 }
+func (s spanTriples) Less(i int, j int) bool {
+	if s[i*3] != s[j*3] {
+		return s[i*3] < s[j*3]
+	}
+	return s[i*3+1] < s[j*3+1]
+}
+func (s spanTriples) Swap(i int, j int) {
+	s[i*3], s[j*3] = s[j*3], s[i*3]
+	s[i*3+1], s[j*3+1] = s[j*3+1], s[i*3+1]
+	s[i*3+2], s[j*3+2] = s[j*3+2], s[i*3+2]
+}
+
+func sortSpans(spans []int) {
+	sort.Sort(spanTriples(spans))
+}
+
+// drawSpans paints a fill region, scaling it to the image
+func drawSpans(img *image.RGBA, spans []int, c color.Color, scale float64) {
+	src := image.NewUniform(c)
+	for i := 0; i+2 < len(spans); i += 3 {
+		y, x0, x1 := float64(spans[i]), float64(spans[i+1]), float64(spans[i+2])
+		rect := image.Rect(
+			int(math.Round(x0*scale)),
+			int(math.Round(y*scale)),
+			int(math.Round(x1*scale)),
+			int(math.Round((y+1)*scale)),
+		)
+		draw.Draw(img, rect.Intersect(img.Bounds()), src, image.Point{}, draw.Over)
+	}
+}
@@ -0,0 +1,629 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Game phases. Outside a game the room is a free-for-all canvas; during a game only the drawer may draw.
+// A prompt game has phases of its own, in which everyone draws to a theme and then votes.
+const (
+	GamePhaseIdle     = "idle"
+	GamePhaseChoosing = "choosing"
+	GamePhaseDrawing  = "drawing"
+	GamePhaseTurnEnd  = "turn_end"
+
+	GamePhasePromptDrawing = "prompt_drawing"
+	GamePhasePromptVoting  = "prompt_voting"
+	GamePhasePromptResults = "prompt_results"
+)
+
+// Game modes: pictionary takes turns at drawing a secret word, prompt has everyone draw the same theme
+const (
+	GameModePictionary = "pictionary"
+	GameModePrompt     = "prompt"
+)
+
+const (
+	DefaultGameRounds = 3
+	MaxGameRounds     = 10
+
+	DefaultTurnSeconds = 80
+	MinTurnSeconds     = 30
+	MaxTurnSeconds     = 240
+
+	MinGamePlayers = 2
+
+	// how long the drawer has to pick a word before one is picked for them
+	WordChoiceDuration = 15 * time.Second
+	// how long the word stays revealed before the next turn starts
+	TurnBreakDuration = 5 * time.Second
+	// the hub advances the game clock this often
+	GameTickInterval = time.Second
+)
+
+// defaultWords make up the built-in word pack, used when no pack files are installed
+var defaultWords = []string{
+	"apple", "banana", "bicycle", "bridge", "butterfly", "cactus", "camera", "castle", "cloud", "clock",
+	"dragon", "elephant", "guitar", "hammer", "helicopter", "house", "island", "kite", "ladder", "lighthouse",
+	"moon", "mountain", "octopus", "penguin", "pizza", "rainbow", "robot", "rocket", "snowman", "spider",
+	"sun", "sword", "tree", "umbrella", "volcano", "whale", "windmill", "wizard", "zebra", "train",
+}
+
+// GameOptions are chosen by the player who starts a game
+type GameOptions struct {
+	// Mode is GameModePictionary or GameModePrompt
+	Mode   string `json:"mode"`
+	Rounds int    `json:"rounds"`
+	// TurnSeconds is how long each turn lasts, or in prompt mode how long everyone has to draw
+	TurnSeconds int `json:"turnSeconds"`
+	// Packs are the word packs to draw from; empty means all of them. Prompt themes come from them too.
+	Packs []string `json:"packs,omitempty"`
+	// Theme is the prompt for every round of a prompt game; a theme is picked from the packs when it is empty
+	Theme string `json:"theme,omitempty"`
+}
+
+// withDefaults fills in options the player left out
+func (o GameOptions) withDefaults() GameOptions {
+	if o.Mode == "" {
+		o.Mode = GameModePictionary
+	}
+	if o.Rounds == 0 {
+		o.Rounds = DefaultGameRounds
+	}
+	if o.TurnSeconds == 0 {
+		o.TurnSeconds = DefaultTurnSeconds
+		if o.Mode == GameModePrompt {
+			o.TurnSeconds = DefaultPromptSeconds
+		}
+	}
+	o.Theme = strings.Join(strings.Fields(o.Theme), " ")
+	return o
+}
+
+func (o GameOptions) Validate() error {
+	if o.Rounds < 1 || o.Rounds > MaxGameRounds {
+		return fmt.Errorf("rounds must be between 1 and %d", MaxGameRounds)
+	}
+	switch o.Mode {
+	case GameModePictionary:
+		if o.TurnSeconds < MinTurnSeconds || o.TurnSeconds > MaxTurnSeconds {
+			return fmt.Errorf("turn length must be between %d and %d seconds", MinTurnSeconds, MaxTurnSeconds)
+		}
+	case GameModePrompt:
+		if o.TurnSeconds < MinTurnSeconds || o.TurnSeconds > MaxPromptSeconds {
+			return fmt.Errorf("drawing time must be between %d and %d seconds", MinTurnSeconds, MaxPromptSeconds)
+		}
+		if utf8.RuneCountInString(o.Theme) > MaxThemeLength {
+			return fmt.Errorf("themes can be at most %d characters", MaxThemeLength)
+		}
+	default:
+		return fmt.Errorf("unknown game mode %q", o.Mode)
+	}
+	return nil
+}
+
+// GameCommand asks the hub to change the game: "start" a game with Options, "choose" Word as the drawer,
+// or "vote" for the drawing of player EntryId in a prompt game
+type GameCommand struct {
+	Type    string
+	Player  *Player
+	Options GameOptions
+	Word    string
+	EntryId string
+}
+
+// GameState is what every player is told about the game. It never contains the word.
+type GameState struct {
+	Phase       string         `json:"phase"`
+	Mode        string         `json:"mode,omitempty"`
+	Theme       string         `json:"theme,omitempty"`
+	Round       int            `json:"round"`
+	TotalRounds int            `json:"totalRounds"`
+	DrawerId    string         `json:"drawerId,omitempty"`
+	DrawerName  string         `json:"drawerName,omitempty"`
+	DrawerEmoji string         `json:"drawerEmoji,omitempty"`
+	WordLength  int            `json:"wordLength,omitempty"`
+	Hint        string         `json:"hint,omitempty"`
+	Guessed     []string       `json:"guessed,omitempty"`
+	PhaseEndsAt time.Time      `json:"phaseEndsAt,omitzero"`
+	Scores      map[string]int `json:"scores"`
+	// TeamScores are kept alongside the players' own scores in team mode
+	TeamScores map[string]int `json:"teamScores,omitempty"`
+}
+
+// Game is the pictionary state of a room. Only the hub goroutine changes it; the mutex lets the
+// connection goroutines check who may draw.
+type Game struct {
+	mu      sync.RWMutex
+	phase   string
+	options GameOptions
+	round   int
+	pending []string // ids of players still to draw this round
+	drawer  *Player
+	words   []string        // every word of the selected packs
+	used    map[string]bool // words already played this game
+	choices []string        // the words the drawer may pick from
+	word    string
+	// letter positions revealed over the turn, of which the first hintsShown are showing
+	hintOrder  []int
+	hintsShown int
+	guessed    map[string]bool // players who found the word this turn
+	phaseEnds  time.Time
+	scores     map[string]int
+	teamScores map[string]int // empty unless the game is played in teams
+	// identities remembers the browser of every player with a score, so their stats count the game after they left
+	identities map[string]string
+
+	// the prompt of the current round, the drawings it is being voted on and who voted for which
+	theme       string
+	challengeId string
+	votes       map[string]string
+
+	// words uploaded for this room, offered as the custom pack
+	customWords []string
+}
+
+func NewGame() *Game {
+	return &Game{
+		phase:      GamePhaseIdle,
+		used:       make(map[string]bool),
+		guessed:    make(map[string]bool),
+		scores:     make(map[string]int),
+		teamScores: make(map[string]int),
+		identities: make(map[string]string),
+		votes:      make(map[string]string),
+	}
+}
+
+// CanDraw reports whether a player may change the canvas: anyone outside a game, only the drawer during one
+func (g *Game) CanDraw(player *Player) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	switch g.phase {
+	case GamePhaseIdle:
+		return true
+	case GamePhaseDrawing:
+		return g.isDrawer(player)
+	case GamePhasePromptDrawing:
+		return true
+	default:
+		return false
+	}
+}
+
+// isDrawer reports whether the player is the drawer, in whichever of their tabs. Player ids are made up by the
+// client, so the drawer is recognised by browser identity. Callers hold g.mu.
+func (g *Game) isDrawer(player *Player) bool {
+	return g.drawer != nil && g.drawer.Identity == player.Identity
+}
+
+func (g *Game) Phase() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.phase
+}
+
+func (g *Game) State() GameState {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	state := GameState{
+		Phase:       g.phase,
+		Round:       g.round,
+		TotalRounds: g.options.Rounds,
+		Theme:       g.theme,
+		PhaseEndsAt: g.phaseEnds,
+		Scores:      make(map[string]int, len(g.scores)),
+	}
+	if g.phase != GamePhaseIdle {
+		state.Mode = g.options.Mode
+	}
+	for id, score := range g.scores {
+		state.Scores[id] = score
+	}
+	if len(g.teamScores) > 0 {
+		state.TeamScores = maps.Clone(g.teamScores)
+	}
+	if g.drawer != nil {
+		state.DrawerId = g.drawer.Id
+		state.DrawerName = g.drawer.PlayerName
+		state.DrawerEmoji = g.drawer.PlayerEmoji
+	}
+	if g.phase == GamePhaseDrawing {
+		state.WordLength = len([]rune(g.word))
+		state.Hint = maskWord(g.word, g.hintOrder[:g.hintsShown])
+	}
+	for id := range g.guessed {
+		state.Guessed = append(state.Guessed, id)
+	}
+	return state
+}
+
+// CustomWords returns the room's own word list
+func (g *Game) CustomWords() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return slices.Clone(g.customWords)
+}
+
+// SetCustomWords replaces the room's own word list; a running game keeps the words it started with
+func (g *Game) SetCustomWords(words []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.customWords = words
+}
+
+func (g *Game) hasGuessed(playerId string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.guessed[playerId]
+}
+
+// playerById finds a joined player of this hub; it must only be called from the hub goroutine
+func (h *Hub) playerById(id string) *Player {
+	for _, player := range h.Players {
+		if player.Id == id && player.PlayerName != "" && player.PlayerEmoji != "" {
+			return player
+		}
+	}
+	return nil
+}
+
+// broadcastEvent sends an event to every player straight from the hub goroutine, which can't use h.Broadcast
+func (h *Hub) broadcastEvent(eventType string, payload any) {
+	eventBytes, err := json.Marshal(map[string]any{
+		"type":    eventType,
+		"payload": payload,
+	})
+	if err != nil {
+		LogError("Error marshaling %s event: %v", eventType, err)
+		return
+	}
+	for _, player := range h.Players {
+		h.send(player, eventBytes)
+	}
+}
+
+// sendEvent sends an event to one player from the hub goroutine
+func (h *Hub) sendEvent(player *Player, eventType string, payload any) {
+	eventBytes, err := json.Marshal(map[string]any{
+		"type":    eventType,
+		"payload": payload,
+	})
+	if err != nil {
+		LogError("Error marshaling %s event: %v", eventType, err)
+		return
+	}
+	h.send(player, eventBytes)
+}
+
+// ChooseWord passes the drawer's pick among the offered words to the hub
+func (h *Hub) ChooseWord(player *Player, word string) {
+	deliver(h, h.GameControl, GameCommand{Type: "choose", Player: player, Word: word})
+}
+
+// VotePrompt passes a player's favourite drawing of a prompt round to the hub
+func (h *Hub) VotePrompt(player *Player, entryId string) {
+	deliver(h, h.GameControl, GameCommand{Type: "vote", Player: player, EntryId: entryId})
+}
+
+// StartGame asks the hub to start a game with the given options
+func (h *Hub) StartGame(player *Player, options GameOptions) {
+	deliver(h, h.GameControl, GameCommand{Type: "start", Player: player, Options: options})
+}
+
+// SendGameState tells a single player, e.g. one that joined late, where the game is at
+func (h *Hub) SendGameState(player *Player) {
+	stateEventBytes, err := json.Marshal(map[string]any{
+		"type":    "game_state",
+		"payload": h.Game.State(),
+	})
+	if err != nil {
+		LogError("Error marshaling game state event: %v", err)
+		return
+	}
+
+	deliver(h, h.Direct, DirectMessage{Player: player, Message: stateEventBytes})
+}
+
+func (h *Hub) handleGameCommand(command GameCommand) {
+	// the player may have disconnected while the command was queued, and only players with a seat may play
+	if _, ok := h.Players[command.Player.Conn]; !ok || !command.Player.seated {
+		return
+	}
+
+	switch command.Type {
+	case "start":
+		if !h.Moderation.IsHost(command.Player.Identity) {
+			h.sendEvent(command.Player, "game_error", map[string]any{"message": "only the host can start a game"})
+			return
+		}
+		if err := h.startGame(command.Player, command.Options.withDefaults(), time.Now()); err != nil {
+			LogInfo("Player %s could not start a game in room %s: %v", command.Player.PlayerName, h.Id, err)
+			h.sendEvent(command.Player, "game_error", map[string]any{"message": err.Error()})
+		}
+	case "choose":
+		g := h.Game
+		g.mu.RLock()
+		valid := g.phase == GamePhaseChoosing && g.isDrawer(command.Player) && slices.Contains(g.choices, command.Word)
+		g.mu.RUnlock()
+		if !valid {
+			LogWarning("Player %s sent a word choice out of turn", command.Player.PlayerName)
+			return
+		}
+		h.startDrawing(command.Word, time.Now())
+	case "vote":
+		if err := h.castPromptVote(command.Player, command.EntryId, time.Now()); err != nil {
+			h.sendEvent(command.Player, "game_error", map[string]any{"message": err.Error()})
+		}
+	default:
+		LogWarning("Unknown game command: %s", command.Type)
+	}
+}
+
+func (h *Hub) startGame(player *Player, options GameOptions, now time.Time) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if len(h.GetActivePlayers()) < MinGamePlayers {
+		return fmt.Errorf("at least %d players are needed to start a game", MinGamePlayers)
+	}
+
+	g := h.Game
+	g.mu.Lock()
+	if g.phase != GamePhaseIdle {
+		g.mu.Unlock()
+		return fmt.Errorf("a game is already running")
+	}
+	words, err := WordPacks.Words(options.Packs, g.customWords)
+	if err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	g.words = words
+	clear(g.used)
+	g.options = options
+	g.round = 0
+	g.pending = nil
+	clear(g.scores)
+	clear(g.identities)
+	for _, active := range h.GetActivePlayers() {
+		g.scores[active.Id] = 0
+		g.identities[active.Id] = active.Identity
+	}
+	clear(g.teamScores)
+	for _, team := range h.teams() {
+		g.teamScores[team] = 0
+	}
+	g.mu.Unlock()
+
+	LogInfo("Player %s started a %s game of %d rounds in room %s", player.PlayerName, options.Mode, options.Rounds, h.Id)
+	IncrementGameEvent("game_start")
+	if options.Mode == GameModePrompt {
+		h.startPrompt(now)
+	} else {
+		h.nextTurn(now)
+	}
+	return nil
+}
+
+// nextTurn hands the canvas to the next player still connected, starting a new round or ending the game
+// when everyone has drawn
+func (h *Hub) nextTurn(now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	var drawer *Player
+	for drawer == nil {
+		if len(g.pending) == 0 {
+			if g.round >= g.options.Rounds {
+				break
+			}
+			g.round++
+			// everyone present at the start of the round draws once, in random order
+			for _, active := range h.GetActivePlayers() {
+				g.pending = append(g.pending, active.Id)
+			}
+			rand.Shuffle(len(g.pending), func(i, j int) {
+				g.pending[i], g.pending[j] = g.pending[j], g.pending[i]
+			})
+			// in team mode the pencil passes from team to team
+			if h.Settings.Teams > 0 {
+				g.pending = interleaveTeams(g.pending, h.teamOf)
+			}
+			if len(g.pending) == 0 {
+				break
+			}
+		}
+		drawer = h.playerById(g.pending[0])
+		g.pending = g.pending[1:]
+	}
+	if drawer == nil {
+		g.mu.Unlock()
+		h.endGame("finished")
+		return
+	}
+
+	g.phase = GamePhaseChoosing
+	g.drawer = drawer
+	g.word = ""
+	g.choices = pickWordChoices(g.words, g.used)
+	clear(g.guessed)
+	g.phaseEnds = now.Add(WordChoiceDuration)
+	if _, ok := g.scores[drawer.Id]; !ok {
+		g.scores[drawer.Id] = 0
+	}
+	g.identities[drawer.Id] = drawer.Identity
+	choices := g.choices
+	round := g.round
+	g.mu.Unlock()
+
+	LogInfo("Round %d in room %s: %s is choosing a word", round, h.Id, drawer.PlayerName)
+	IncrementGameEvent("turn_start")
+
+	// every turn starts on an empty canvas
+	h.Canvas.Clear()
+	h.Recorder.Record(SessionEvent{Time: now, Type: "clear"})
+	h.broadcastEvent("clear", map[string]any{})
+
+	h.broadcastEvent("game_state", g.State())
+	h.sendEvent(drawer, "word_choices", map[string]any{"words": choices})
+}
+
+// startDrawing starts the turn's clock once the drawer has a word
+func (h *Hub) startDrawing(word string, now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	g.phase = GamePhaseDrawing
+	g.word = word
+	g.used[word] = true
+	g.choices = nil
+	g.hintOrder = hintLetters(word)
+	g.hintsShown = 0
+	g.phaseEnds = now.Add(time.Duration(g.options.TurnSeconds) * time.Second)
+	drawer := g.drawer
+	g.mu.Unlock()
+
+	h.broadcastEvent("game_state", g.State())
+	// only the drawer learns the word
+	h.sendEvent(drawer, "secret_word", map[string]any{"word": word})
+	h.sendHints()
+}
+
+// endTurn reveals the word and pauses briefly before the next turn
+func (h *Hub) endTurn(reason string, now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	g.phase = GamePhaseTurnEnd
+	g.phaseEnds = now.Add(TurnBreakDuration)
+	drawerId := g.drawer.Id
+	word := g.word
+	g.word = ""
+	g.mu.Unlock()
+
+	IncrementGameEvent("turn_end")
+	h.broadcastEvent("turn_end", map[string]any{
+		"drawerId": drawerId,
+		"word":     word,
+		"reason":   reason,
+	})
+	h.broadcastEvent("game_state", g.State())
+}
+
+// endGame announces the final scores and hands the canvas back to everyone
+func (h *Hub) endGame(reason string) {
+	g := h.Game
+	g.mu.Lock()
+	word := ""
+	if g.phase == GamePhaseDrawing {
+		word = g.word
+	}
+	g.phase = GamePhaseIdle
+	g.drawer = nil
+	g.word = ""
+	g.choices = nil
+	clear(g.guessed)
+	g.pending = nil
+	g.phaseEnds = time.Time{}
+	g.theme = ""
+	g.challengeId = ""
+	clear(g.votes)
+	g.mu.Unlock()
+
+	LogInfo("Game in room %s ended: %s", h.Id, reason)
+	IncrementGameEvent("game_over")
+	state := g.State()
+	gameOver := map[string]any{
+		"reason": reason,
+		"word":   word,
+		"scores": state.Scores,
+	}
+	if state.TeamScores != nil {
+		gameOver["teamScores"] = state.TeamScores
+	}
+	h.broadcastEvent("game_over", gameOver)
+	h.broadcastEvent("game_state", state)
+	h.recordGameStats(state.Scores, reason == "finished")
+}
+
+// recordGameStats adds the final scores to every player's stats. Only a game played to the end has winners:
+// whoever has the top score, if anyone scored at all.
+func (h *Hub) recordGameStats(scores map[string]int, finished bool) {
+	best := 0
+	for _, score := range scores {
+		best = max(best, score)
+	}
+	h.Game.mu.RLock()
+	identities := maps.Clone(h.Game.identities)
+	h.Game.mu.RUnlock()
+
+	for id, score := range scores {
+		player := h.playerById(id)
+		if player == nil {
+			// players who left keep their name from earlier stats
+			player = &Player{Id: id, Identity: identities[id]}
+		}
+		Stats.RecordGame(player, score, finished && best > 0 && score == best)
+	}
+}
+
+// tickGame advances the game clock; it runs on the hub goroutine
+func (h *Hub) tickGame(now time.Time) {
+	g := h.Game
+	g.mu.RLock()
+	phase := g.phase
+	phaseEnds := g.phaseEnds
+	drawer := g.drawer
+	g.mu.RUnlock()
+
+	if phase == GamePhaseIdle {
+		return
+	}
+	if len(h.GetActivePlayers()) < MinGamePlayers {
+		h.endGame("not_enough_players")
+		return
+	}
+
+	switch phase {
+	case GamePhaseChoosing:
+		if h.playerById(drawer.Id) == nil {
+			h.nextTurn(now)
+		} else if !now.Before(phaseEnds) {
+			g.mu.RLock()
+			word := g.choices[0]
+			g.mu.RUnlock()
+			h.startDrawing(word, now)
+		}
+	case GamePhaseDrawing:
+		if h.playerById(drawer.Id) == nil {
+			h.endTurn("drawer_left", now)
+		} else if !now.Before(phaseEnds) {
+			h.endTurn("time_up", now)
+		} else {
+			h.updateHints(now)
+		}
+	case GamePhaseTurnEnd:
+		if !now.Before(phaseEnds) {
+			h.nextTurn(now)
+		}
+	case GamePhasePromptDrawing:
+		if !now.Before(phaseEnds) {
+			h.endPromptDrawing(now)
+		}
+	case GamePhasePromptVoting:
+		if !now.Before(phaseEnds) {
+			h.endPromptVoting(now)
+		}
+	case GamePhasePromptResults:
+		if !now.Before(phaseEnds) {
+			h.startPrompt(now)
+		}
+	}
+}
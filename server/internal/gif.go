@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bufio"
+	"compress/lzw"
+	"encoding/binary"
+	"image"
+	"image/color/palette"
+	"io"
+)
+
+// gifEncoder writes an animated GIF one frame at a time. image/gif can only encode a whole animation at once,
+// which means holding every frame in memory first. Frames share the global Plan 9 palette.
+type gifEncoder struct {
+	w *bufio.Writer
+}
+
+func newGIFEncoder(w io.Writer) *gifEncoder {
+	return &gifEncoder{w: bufio.NewWriter(w)}
+}
+
+// writeHeader writes the screen size, the global palette and the extension that makes the animation loop forever
+func (e *gifEncoder) writeHeader(width, height int) error {
+	e.w.WriteString("GIF89a")
+	e.writeUint16(width)
+	e.writeUint16(height)
+	// global colour table of 256 entries at 8 bits per channel
+	e.w.Write([]byte{0xf7, 0x00, 0x00})
+	for _, c := range palette.Plan9 {
+		r, g, b, _ := c.RGBA()
+		e.w.Write([]byte{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)})
+	}
+
+	e.w.Write([]byte{0x21, 0xff, 0x0b})
+	e.w.WriteString("NETSCAPE2.0")
+	_, err := e.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	return err
+}
+
+// writeFrame writes a full-size frame shown for delay hundredths of a second
+func (e *gifEncoder) writeFrame(frame *image.Paletted, delay int) error {
+	e.w.Write([]byte{0x21, 0xf9, 0x04, 0x00})
+	e.writeUint16(delay)
+	e.w.Write([]byte{0x00, 0x00})
+
+	e.w.WriteByte(0x2c)
+	e.writeUint16(0)
+	e.writeUint16(0)
+	e.writeUint16(frame.Rect.Dx())
+	e.writeUint16(frame.Rect.Dy())
+	e.w.WriteByte(0x00)
+
+	// pixel data is LZW compressed with 8 bit codes and split into sub-blocks of at most 255 bytes
+	e.w.WriteByte(0x08)
+	blocks := &gifBlockWriter{w: e.w}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, 8)
+	width := frame.Rect.Dx()
+	for y := 0; y < frame.Rect.Dy(); y++ {
+		row := frame.Pix[y*frame.Stride : y*frame.Stride+width]
+		if _, err := compressor.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	return blocks.close()
+}
+
+// close writes the trailer and flushes whatever is still buffered
+func (e *gifEncoder) close() error {
+	e.w.WriteByte(0x3b)
+	return e.w.Flush()
+}
+
+func (e *gifEncoder) writeUint16(v int) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], uint16(v))
+	e.w.Write(b[:])
+}
+
+// gifBlockWriter splits image data into length-prefixed sub-blocks
+type gifBlockWriter struct {
+	w     *bufio.Writer
+	block [255]byte
+	n     int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		copied := copy(b.block[b.n:], p)
+		b.n += copied
+		written += copied
+		p = p[copied:]
+		if b.n == len(b.block) {
+			if err := b.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.w.WriteByte(uint8(b.n))
+	_, err := b.w.Write(b.block[:b.n])
+	b.n = 0
+	return err
+}
+
+// close flushes the last sub-block and writes the block terminator
+func (b *gifBlockWriter) close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	return b.w.WriteByte(0x00)
+}
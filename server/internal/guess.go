@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// a correct guess is worth between these, depending on how much of the turn was left
+	MaxGuessPoints = 500
+	MinGuessPoints = 100
+	// the drawer earns this for every player who guesses their word
+	DrawerPointsPerGuess = 50
+)
+
+// accentFolds maps accented Latin letters onto their plain form so "café" and "cafe" are the same guess
+var accentFolds = map[rune]string{}
+
+func init() {
+	for plain, accented := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđ", "e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥħ",
+		"i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő",
+		"r": "ŕŗř", "s": "śŝşš", "t": "ţťŧ", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+		"ae": "æ", "oe": "œ", "ss": "ß",
+	} {
+		for _, r := range accented {
+			accentFolds[r] = plain
+		}
+	}
+}
+
+// ChatMessage is a chat line on its way through the hub, which decides who gets to see it
+type ChatMessage struct {
+	Player *Player
+	Text   string
+	// TeamOnly keeps the message within the sender's team; outside team mode it reaches everyone as usual
+	TeamOnly bool
+	Message  []byte
+}
+
+// normalizeGuess lowercases and folds accents, keeping only letters and digits separated by single spaces
+func normalizeGuess(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		folded, ok := accentFolds[r]
+		if !ok && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			folded, ok = string(r), true
+		}
+		if !ok {
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteString(folded)
+	}
+	return b.String()
+}
+
+// editDistance is the Levenshtein distance between two strings, counted in runes
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
+
+// isCloseGuess allows one typo in short words and two in longer ones
+func isCloseGuess(guess string, word string) bool {
+	allowed := 1
+	if len([]rune(word)) > 5 {
+		allowed = 2
+	}
+	return editDistance(guess, word) <= allowed
+}
+
+// guessPoints weights a correct guess by how much of the turn was left when it was made
+func guessPoints(remaining time.Duration, turn time.Duration) int {
+	fraction := min(max(float64(remaining)/float64(turn), 0), 1)
+	return MinGuessPoints + int(fraction*float64(MaxGuessPoints-MinGuessPoints)+0.5)
+}
+
+// SendChat hands a chat message to the hub, which checks it against the word during a turn
+func (h *Hub) SendChat(player *Player, text string, teamOnly bool, message []byte) {
+	deliver(h, h.Chat, ChatMessage{Player: player, Text: text, TeamOnly: teamOnly, Message: message})
+}
+
+// handleChat delivers a chat message. During a turn, messages are treated as guesses: a correct guess is
+// announced without the word, and the drawer and players who already guessed only chat among themselves.
+// Team chat is checked as a guess like any other message, but otherwise only reaches the sender's team.
+func (h *Hub) handleChat(chat ChatMessage, now time.Time) {
+	// the player may have disconnected while the message was queued, and only players with a seat may chat
+	if _, ok := h.Players[chat.Player.Conn]; !ok || !chat.Player.seated {
+		return
+	}
+	if h.Moderation.IsMuted(chat.Player.Identity) {
+		h.sendEvent(chat.Player, "moderation_error", map[string]any{"message": "you have been muted by the host"})
+		return
+	}
+
+	g := h.Game
+	g.mu.RLock()
+	drawing := g.phase == GamePhaseDrawing
+	word := g.word
+	isDrawer := g.isDrawer(chat.Player)
+	alreadyGuessed := g.guessed[chat.Player.Id]
+	g.mu.RUnlock()
+
+	if !drawing {
+		h.sendChat(chat)
+		return
+	}
+
+	if isDrawer || alreadyGuessed {
+		h.sendToGuessers(chat)
+		return
+	}
+
+	guess := normalizeGuess(chat.Text)
+	target := normalizeGuess(word)
+	switch {
+	case guess == target:
+		h.correctGuess(chat.Player, now)
+	case guess != "" && isCloseGuess(guess, target):
+		IncrementGameEvent("guess_close")
+		// a near miss would give the word away, so only the guesser sees it
+		h.send(chat.Player, chat.Message)
+		h.sendEvent(chat.Player, "guess_close", map[string]any{"guess": chat.Text})
+	default:
+		h.sendChat(chat)
+	}
+}
+
+// chatReaches reports whether player gets to see a chat message
+func chatReaches(chat ChatMessage, player *Player) bool {
+	return !chat.TeamOnly || chat.Player.Team == "" || player.Team == chat.Player.Team
+}
+
+// sendChat delivers a chat message to the room, or only to the sender's team for team chat
+func (h *Hub) sendChat(chat ChatMessage) {
+	for _, player := range h.Players {
+		if chatReaches(chat, player) {
+			h.send(player, chat.Message)
+		}
+	}
+}
+
+// sendToGuessers delivers a message only to the drawer and the players who know the word
+func (h *Hub) sendToGuessers(chat ChatMessage) {
+	g := h.Game
+	g.mu.RLock()
+	recipients := make([]*Player, 0, len(g.guessed)+1)
+	for _, player := range h.Players {
+		if (g.isDrawer(player) || g.guessed[player.Id]) && chatReaches(chat, player) {
+			recipients = append(recipients, player)
+		}
+	}
+	g.mu.RUnlock()
+
+	for _, player := range recipients {
+		h.send(player, chat.Message)
+	}
+}
+
+func (h *Hub) correctGuess(player *Player, now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	points := guessPoints(g.phaseEnds.Sub(now), time.Duration(g.options.TurnSeconds)*time.Second)
+	g.guessed[player.Id] = true
+	g.scores[player.Id] += points
+	g.scores[g.drawer.Id] += DrawerPointsPerGuess
+	g.identities[player.Id] = player.Identity
+	// team scores count points for whichever team the players are on when they score
+	if player.Team != "" {
+		g.teamScores[player.Team] += points
+	}
+	if g.drawer.Team != "" {
+		g.teamScores[g.drawer.Team] += DrawerPointsPerGuess
+	}
+	drawerId := g.drawer.Id
+	word := g.word
+	g.mu.Unlock()
+
+	LogInfo("Player %s guessed the word in room %s for %d points", player.PlayerName, h.Id, points)
+	IncrementGameEvent("guess_correct")
+	Stats.RecordCorrectGuess(player)
+	h.broadcastEvent("guess_correct", map[string]any{
+		"id":           player.Id,
+		"playerName":   player.PlayerName,
+		"playerEmoji":  player.PlayerEmoji,
+		"points":       points,
+		"drawerId":     drawerId,
+		"drawerPoints": DrawerPointsPerGuess,
+	})
+	h.broadcastEvent("game_state", g.State())
+	h.sendEvent(player, "hint", map[string]any{"hint": maskWord(word, allLetters(word))})
+
+	// the turn is over once everyone but the drawer has the word
+	for _, active := range h.GetActivePlayers() {
+		if active.Id != drawerId && !g.hasGuessed(active.Id) {
+			return
+		}
+	}
+	h.endTurn("all_guessed", now)
+}
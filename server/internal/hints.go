@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// hintLetters lists the positions of the word's letters in the order they will be revealed
+func hintLetters(word string) []int {
+	var positions []int
+	for i, r := range []rune(word) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			positions = append(positions, i)
+		}
+	}
+	rand.Shuffle(len(positions), func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	})
+	// never give away more than half of the word
+	return positions[:(len(positions)-1)/2]
+}
+
+// hintsDue is how many letters should be showing after elapsed of the turn.
+// Reveals are spread evenly so the last one comes with a share of the turn still left to guess.
+func hintsDue(total int, elapsed time.Duration, turn time.Duration) int {
+	if total == 0 || turn <= 0 {
+		return 0
+	}
+	due := int(float64(elapsed) / float64(turn) * float64(total+1))
+	return min(max(due, 0), total)
+}
+
+// maskWord shows the revealed letters and an underscore for every other letter, e.g. "_ _ a _ _".
+// Spaces and punctuation are always shown; words are separated by a wider gap.
+func maskWord(word string, revealed []int) string {
+	show := make(map[int]bool, len(revealed))
+	for _, i := range revealed {
+		show[i] = true
+	}
+
+	parts := make([]string, 0, len(word))
+	for i, r := range []rune(word) {
+		switch {
+		case r == ' ':
+			parts = append(parts, " ")
+		case show[i] || !(unicode.IsLetter(r) || unicode.IsDigit(r)):
+			parts = append(parts, string(r))
+		default:
+			parts = append(parts, "_")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// updateHints reveals the letters due at now and sends the new hint; it runs on the hub goroutine
+func (h *Hub) updateHints(now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	turn := time.Duration(g.options.TurnSeconds) * time.Second
+	due := hintsDue(len(g.hintOrder), turn-g.phaseEnds.Sub(now), turn)
+	if due <= g.hintsShown {
+		g.mu.Unlock()
+		return
+	}
+	g.hintsShown = due
+	g.mu.Unlock()
+
+	IncrementGameEvent("hint")
+	h.sendHints()
+}
+
+// sendHints gives guessers the masked word, while the drawer and players who already guessed get it in full
+func (h *Hub) sendHints() {
+	g := h.Game
+	g.mu.RLock()
+	hint := maskWord(g.word, g.hintOrder[:g.hintsShown])
+	word := g.word
+	knowers := make(map[*Player]bool)
+	for _, player := range h.Players {
+		if g.isDrawer(player) || g.guessed[player.Id] {
+			knowers[player] = true
+		}
+	}
+	g.mu.RUnlock()
+
+	for _, player := range h.Players {
+		if knowers[player] {
+			h.sendEvent(player, "hint", map[string]any{"hint": maskWord(word, allLetters(word))})
+		} else {
+			h.sendEvent(player, "hint", map[string]any{"hint": hint})
+		}
+	}
+}
+
+func allLetters(word string) []int {
+	positions := make([]int, len([]rune(word)))
+	for i := range positions {
+		positions[i] = i
+	}
+	return positions
+}
@@ -2,80 +2,413 @@ package internal
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	// PlayerSendBuffer is how many outgoing messages may queue up for a player before it counts as too slow
+	PlayerSendBuffer = 256
+	// cursor updates are only queued while a player's queue is less full than this, so they never delay strokes
+	cursorQueueLimit = PlayerSendBuffer / 4
+	// cursor positions are coalesced per player and sent at most this often
+	CursorFlushInterval = 50 * time.Millisecond
+	// a write that takes longer than this counts as failed, so a stalled client can't hold its write pump forever
+	writeWait = 10 * time.Second
+)
+
+// Player is one connection to a room. Once it is registered, Id, PlayerName, PlayerEmoji and Team belong to the
+// hub goroutine, which fills them in when the player gets a seat; the connection's own goroutines must not read them.
 type Player struct {
 	Id          string `json:"id"`
 	PlayerName  string `json:"playerName"`
 	PlayerEmoji string `json:"playerEmoji"`
 	Conn        *websocket.Conn
+	// Identity and IP are what bans are checked against; they are never sent to other players
+	Identity string `json:"-"`
+	IP       string `json:"-"`
+	// Token lets the browser use the room's HTTP API, e.g. to upload images, for as long as this connection
+	// is open; only the player is told it
+	Token string `json:"-"`
+	// Spectator connections only watch: they never join, so they can't draw, clear or chat
+	Spectator bool `json:"-"`
+	// Team is the player's team in team mode; the hub picks it when the player gets a seat
+	Team string `json:"team,omitempty"`
+	// seated is set by the hub once the player has a seat; only players with one can draw, chat or play
+	seated bool
+	// Send queues outgoing messages for WritePump; the hub closes it when it drops the player
+	Send chan []byte `json:"-"`
+}
+
+// NewConnectionToken makes the token a new connection uses for the room's HTTP API
+func NewConnectionToken() string {
+	return randomHex(16)
+}
+
+// WritePump writes queued messages to the connection; it is the only goroutine that writes to it
+func (p *Player) WritePump() {
+	for message := range p.Send {
+		p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := p.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			LogError("Error writing to connection: %v", err)
+			IncrementWebSocketError("write_failed")
+			// keep draining so the hub never blocks on this player; the read loop will notice the dead connection
+			continue
+		}
+		IncrementWebSocketMessageSent()
+	}
+	p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	p.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	// unblock the read loop of a player the hub dropped, e.g. one that was kicked
+	p.Conn.Close()
+}
+
+// DirectMessage is delivered to a single player instead of the whole room
+type DirectMessage struct {
+	Player  *Player
+	Message []byte
 }
 
+// CursorUpdate is a player's latest pointer position, which is never stored in canvas history
+type CursorUpdate struct {
+	Player *Player
+	X      float64
+	Y      float64
+}
+
+// CanvasEdit is a change to the canvas: a "draw", "path", "fill", "image" or "clear" by Player, described by Op,
+// or a "load" of whole new Ops. Edits are applied on the hub goroutine, so the history, the recording and what
+// players receive all keep the same order.
+type CanvasEdit struct {
+	Type   string
+	Player *Player
+	Op     CanvasOp
+	Ops    []CanvasOp
+	result chan error
+}
+
+// ErrGameRunning is returned for changes that have to wait until the game is over
+var ErrGameRunning = errors.New("a game is running in this room")
+
 type Hub struct {
+	Id string
+	// Settings only change on the hub goroutine, under settingsMu; other goroutines read them with CurrentSettings
+	Settings   RoomSettings
+	settingsMu sync.RWMutex
+	Canvas     *Canvas
+	Recorder   *SessionRecorder
+	Game       *Game
+	// Gallery keeps the drawings of the room's prompt challenges
+	Gallery    *Gallery
+	Moderation *Moderation
+	Access     *RoomAccess
 	Players    map[*websocket.Conn]*Player
 	Broadcast  chan []byte
+	Chat       chan ChatMessage
 	Register   chan *Player
 	Unregister chan *Player
+	Direct     chan DirectMessage
+	Cursor     chan CursorUpdate
+	// Edits carries changes to the canvas history
+	Edits chan CanvasEdit
+	// GameControl carries requests to start or change the game, which only the hub goroutine may do
+	GameControl chan GameCommand
+	// Moderate carries host actions and votes, which only the hub goroutine may carry out
+	Moderate chan ModerationCommand
+	// Seats carries join requests, which the hub checks against the room's capacity
+	Seats chan SeatRequest
+	// Configure carries changes to the room's settings and access
+	Configure chan RoomUpdate
+	// closing asks the hub to drop everyone and stop; done is closed once it has
+	closing chan string
+	done    chan struct{}
+	// onIdle is called once the room has been empty for RoomIdleTimeout; the default room has none and never closes
+	onIdle     func()
+	emptySince time.Time
+	// ownerToken lets whoever created the room through the API change or delete it
+	ownerToken string
+	// vote is the running vote-kick or vote-clear, if any
+	vote *Vote
+	// lastActive is when each browser in the room last did anything, which tells whether the host is around
+	lastActive map[string]time.Time
+	// queue holds the players waiting for a seat in a full room, first come first served
+	queue []SeatRequest
+	// summary is what the lobby last heard about the room; lobby is set once the room is added to Rooms
+	summaryMu sync.RWMutex
+	summary   RoomSummary
+	lobby     *Lobby
+	// tokens maps the token of every open connection to its identity, for HTTP handlers to check
+	tokensMu sync.RWMutex
+	tokens   map[string]string
+	// players is the joined players as of the hub's last change, for HTTP handlers to list
+	playersMu sync.RWMutex
+	players   []Player
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		Players:    make(map[*websocket.Conn]*Player),
-		Broadcast:  make(chan []byte),
-		Register:   make(chan *Player),
-		Unregister: make(chan *Player),
+func NewHub(id string, settings RoomSettings) *Hub {
+	h := &Hub{
+		Id:          id,
+		Settings:    settings,
+		Canvas:      NewCanvas(settings.CanvasWidth, settings.CanvasHeight, settings.Background),
+		Recorder:    NewSessionRecorder(),
+		Game:        NewGame(),
+		Gallery:     NewGallery(),
+		Moderation:  NewModeration(),
+		Access:      NewRoomAccess(),
+		Players:     make(map[*websocket.Conn]*Player),
+		Broadcast:   make(chan []byte),
+		Chat:        make(chan ChatMessage),
+		Register:    make(chan *Player),
+		Unregister:  make(chan *Player),
+		Direct:      make(chan DirectMessage),
+		Cursor:      make(chan CursorUpdate),
+		Edits:       make(chan CanvasEdit),
+		GameControl: make(chan GameCommand),
+		Moderate:    make(chan ModerationCommand),
+		Seats:       make(chan SeatRequest),
+		Configure:   make(chan RoomUpdate),
+		closing:     make(chan string),
+		done:        make(chan struct{}),
+		emptySince:  time.Now(),
+		tokens:      make(map[string]string),
+		lastActive:  make(map[string]time.Time),
 	}
+	h.summary = h.computeSummary()
+	return h
+}
+
+// TokenIdentity returns the identity of the open connection the token was issued to; it can be called from
+// any goroutine
+func (h *Hub) TokenIdentity(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	h.tokensMu.RLock()
+	defer h.tokensMu.RUnlock()
+	identity, ok := h.tokens[token]
+	return identity, ok
+}
+
+// deliver hands v to the hub goroutine, or drops it once the hub has stopped so the caller never blocks forever
+func deliver[T any](h *Hub, ch chan T, v T) {
+	select {
+	case ch <- v:
+	case <-h.done:
+	}
+}
+
+// Connect adds a new connection to the room; it returns false if the room has already closed
+func (h *Hub) Connect(player *Player) bool {
+	select {
+	case h.Register <- player:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+func (h *Hub) Disconnect(player *Player) {
+	deliver(h, h.Unregister, player)
+}
+
+// Close drops every connection with reason and stops the hub; it returns once the hub has stopped
+func (h *Hub) Close(reason string) {
+	deliver(h, h.closing, reason)
+	<-h.done
 }
 
 func (h *Hub) Run() {
 	LogInfo("Hub running in its goroutine")
+	defer close(h.done)
+
+	// latest cursor position per player since the last flush
+	pendingCursors := make(map[*Player]Point)
+	cursorTicker := time.NewTicker(CursorFlushInterval)
+	defer cursorTicker.Stop()
+
+	// rounds and turns are timed by the hub so every player sees the same clock
+	gameTicker := time.NewTicker(GameTickInterval)
+	defer gameTicker.Stop()
+
 	for {
 		select {
 		case newConnection := <-h.Register:
 			LogInfo("New connection registered")
+			// the first connection to an empty room starts a new recorded session
+			if len(h.Players) == 0 {
+				h.Recorder.Begin(h.Canvas)
+			}
 			h.Players[newConnection.Conn] = newConnection
+			h.tokensMu.Lock()
+			h.tokens[newConnection.Token] = newConnection.Identity
+			h.tokensMu.Unlock()
+			// spectators don't join, so this is how they learn who is on which team
+			if h.Settings.Teams > 0 {
+				h.sendEvent(newConnection, "teams", h.teamState())
+			}
 			// Update active players count (this includes connections that haven't completed join)
-			SetActivePlayersCount(float64(len(h.GetActivePlayers())))
+			SetActivePlayersCount(h.Id, float64(len(h.GetActivePlayers())))
+			SetActiveSpectatorsCount(h.Id, float64(h.spectatorCount()))
 		case disconnectedConnection := <-h.Unregister:
 			LogInfo("Connection unregistered")
 			// Check if this was a fully joined player before deletion
-			if disconnectedConnection.Id != "" && disconnectedConnection.PlayerName != "" && disconnectedConnection.PlayerEmoji != "" {
+			if disconnectedConnection.seated {
 				IncrementPlayerLeft()
 			}
-			delete(h.Players, disconnectedConnection.Conn)
+			delete(pendingCursors, disconnectedConnection)
+			h.removePlayer(disconnectedConnection)
 			// Update active players count
-			SetActivePlayersCount(float64(len(h.GetActivePlayers())))
+			SetActivePlayersCount(h.Id, float64(len(h.GetActivePlayers())))
+			SetActiveSpectatorsCount(h.Id, float64(h.spectatorCount()))
+		case direct := <-h.Direct:
+			// the player may have disconnected while the message was queued
+			if _, ok := h.Players[direct.Player.Conn]; !ok {
+				continue
+			}
+			h.send(direct.Player, direct.Message)
+		case cursor := <-h.Cursor:
+			if !cursor.Player.seated {
+				continue
+			}
+			h.markActive(cursor.Player)
+			pendingCursors[cursor.Player] = Point{X: cursor.X, Y: cursor.Y}
+		case <-cursorTicker.C:
+			for player, position := range pendingCursors {
+				h.flushCursor(player, position)
+			}
+			clear(pendingCursors)
+		case chat := <-h.Chat:
+			h.markActive(chat.Player)
+			h.handleChat(chat, time.Now())
+		case request := <-h.Seats:
+			h.handleSeatRequest(request)
+		case edit := <-h.Edits:
+			h.markActive(edit.Player)
+			h.applyEdit(edit)
+		case update := <-h.Configure:
+			update.result <- h.applyUpdate(update)
+		case reason := <-h.closing:
+			h.close(reason)
+			return
+		case command := <-h.Moderate:
+			h.markActive(command.Player)
+			h.handleModeration(command)
+		case command := <-h.GameControl:
+			h.markActive(command.Player)
+			h.handleGameCommand(command)
+		case now := <-gameTicker.C:
+			h.tickGame(now)
+			h.tickVote(now)
+			if h.onIdle != nil && len(h.Players) == 0 && now.Sub(h.emptySince) >= RoomIdleTimeout {
+				// the callback closes the room, which goes through this goroutine
+				go h.onIdle()
+				h.onIdle = nil
+			}
 		case message := <-h.Broadcast:
 			LogDebug("Broadcasting message")
 
-			// unmarshal message
-			var messageData map[string]any
-			if err := json.Unmarshal(message, &messageData); err != nil {
-				LogError("Error unmarshalling message: %v", err)
-				continue
+			// draws, joins and leaves skip the player's own connections, so they go through broadcastPlayerEvent instead
+			for _, player := range h.Players {
+				h.send(player, message)
 			}
+		}
 
-			for conn, player := range h.Players {
-				// skip if message is a draw, path, or player join message and the player is the one who did it (handling it special for this case)
-				if messageData["type"] == "draw" || messageData["type"] == "path" || messageData["type"] == "player_join" || messageData["type"] == "player_leave" {
-					playerId := messageData["payload"].(map[string]any)["id"].(string)
-					if playerId == player.Id {
-						continue
-					}
-				}
-				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-					LogError("Error broadcasting to connection: %v", err)
-					IncrementWebSocketError("broadcast_failed")
-					// Auto cleanup on write error
-					delete(h.Players, conn)
-				} else {
-					IncrementWebSocketMessageSent()
-				}
-			}
+		// whatever just happened may have freed a seat or changed what the lobby and the player list show
+		h.admitQueued()
+		h.publishSummary()
+		h.publishPlayers()
+	}
+}
+
+// send queues a message without blocking the hub. A player whose queue is full can't keep up and is dropped.
+func (h *Hub) send(player *Player, message []byte) {
+	// a player dropped earlier in the same pass has a closed queue
+	if _, ok := h.Players[player.Conn]; !ok {
+		return
+	}
+	select {
+	case player.Send <- message:
+	default:
+		LogWarning("Dropping slow connection for player %s (%s)", player.Id, player.PlayerName)
+		IncrementWebSocketError("send_queue_full")
+		h.removePlayer(player)
+	}
+}
+
+// removePlayer forgets a connection and stops its write pump; it is safe to call more than once
+func (h *Hub) removePlayer(player *Player) {
+	if _, ok := h.Players[player.Conn]; !ok {
+		return
+	}
+	delete(h.Players, player.Conn)
+	close(player.Send)
+	h.tokensMu.Lock()
+	delete(h.tokens, player.Token)
+	h.tokensMu.Unlock()
+	if player.seated {
+		h.broadcastPlayerEvent(player, "player_leave", map[string]any{
+			"id":          player.Id,
+			"playerName":  player.PlayerName,
+			"playerEmoji": player.PlayerEmoji,
+		})
+	}
+	h.playerLeftModeration(player)
+	h.playerLeftVote(player)
+	h.leaveQueue(player)
+	if len(h.Players) == 0 {
+		h.Recorder.End()
+		h.emptySince = time.Now()
+	}
+}
+
+// flushCursor sends a player's latest cursor position to everyone else.
+// Cursors are the first thing dropped when a connection falls behind.
+func (h *Hub) flushCursor(player *Player, position Point) {
+	if _, ok := h.Players[player.Conn]; !ok {
+		return
+	}
+
+	cursorEventData := map[string]any{
+		"type": "cursor",
+		"payload": map[string]any{
+			"id":          player.Id,
+			"playerName":  player.PlayerName,
+			"playerEmoji": player.PlayerEmoji,
+			"x":           position.X,
+			"y":           position.Y,
+		},
+	}
+
+	cursorEventBytes, err := json.Marshal(cursorEventData)
+	if err != nil {
+		LogError("Error marshaling cursor event: %v", err)
+		return
+	}
+
+	for _, other := range h.Players {
+		if other == player {
+			continue
+		}
+		if len(other.Send) >= cursorQueueLimit {
+			IncrementWebSocketMessageDropped("cursor")
+			continue
+		}
+		other.Send <- cursorEventBytes
+	}
+}
+
+func (h *Hub) spectatorCount() int {
+	count := 0
+	for _, player := range h.Players {
+		if player.Spectator {
+			count++
 		}
 	}
+	return count
 }
 
 func (h *Hub) GetActivePlayers() []Player {
@@ -87,128 +420,359 @@ func (h *Hub) GetActivePlayers() []Player {
 				Id:          player.Id,
 				PlayerName:  player.PlayerName,
 				PlayerEmoji: player.PlayerEmoji,
+				Team:        player.Team,
 			})
 		}
 	}
 	return players
 }
 
-func (h *Hub) BroadcastPlayerLeave(player *Player) {
-	if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
-		// Create player leave event
-		leaveEventData := map[string]any{
-			"type": "player_leave",
-			"payload": map[string]any{
-				"id":          player.Id,
-				"playerName":  player.PlayerName,
-				"playerEmoji": player.PlayerEmoji,
-			},
-		}
+// ActivePlayers is GetActivePlayers as of the hub's last change; unlike GetActivePlayers it is safe to call from
+// any goroutine
+func (h *Hub) ActivePlayers() []Player {
+	h.playersMu.RLock()
+	defer h.playersMu.RUnlock()
+	return h.players
+}
 
-		leaveEventBytes, err := json.Marshal(leaveEventData)
-		if err != nil {
-			LogError("Error marshaling leave event: %v", err)
-			return
+// publishPlayers takes a new snapshot for ActivePlayers; the old one is never changed, since readers may still hold it
+func (h *Hub) publishPlayers() {
+	players := h.GetActivePlayers()
+	h.playersMu.Lock()
+	h.players = players
+	h.playersMu.Unlock()
+}
+
+// broadcastPlayerJoin tells everyone but the player's own connections that they joined
+func (h *Hub) broadcastPlayerJoin(player *Player) {
+	h.broadcastPlayerEvent(player, "player_join", map[string]any{
+		"id":          player.Id,
+		"playerName":  player.PlayerName,
+		"playerEmoji": player.PlayerEmoji,
+		"team":        player.Team,
+	})
+}
+
+// broadcastPlayerEvent sends an event about a player to everyone except that player's own connections
+func (h *Hub) broadcastPlayerEvent(player *Player, eventType string, payload map[string]any) {
+	eventBytes, err := json.Marshal(map[string]any{
+		"type":    eventType,
+		"payload": payload,
+	})
+	if err != nil {
+		LogError("Error marshaling %s event: %v", eventType, err)
+		return
+	}
+	for _, other := range h.Players {
+		if other.Id == player.Id {
+			continue
 		}
+		h.send(other, eventBytes)
+	}
+}
 
-		h.Broadcast <- leaveEventBytes
+// mayDraw checks that the player may change the canvas: during a game only the drawer may, and the host
+// can limit drawing to some players
+func (h *Hub) mayDraw(player *Player) bool {
+	if !h.Moderation.CanDraw(player.Identity) {
+		LogDebug("Ignoring canvas change from %s, who is locked out of drawing", player.PlayerName)
+		IncrementModerationAction("draw_rejected")
+		return false
 	}
+	if !h.Game.CanDraw(player) {
+		LogDebug("Ignoring canvas change from %s, who is not drawing", player.PlayerName)
+		IncrementGameEvent("draw_rejected")
+		return false
+	}
+	return true
 }
 
-func (h *Hub) BroadcastPlayerJoin(player *Player) {
-	if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
-		// Create player join event
-		joinEventData := map[string]any{
-			"type": "player_join",
-			"payload": map[string]any{
-				"id":          player.Id,
-				"playerName":  player.PlayerName,
-				"playerEmoji": player.PlayerEmoji,
-			},
-		}
+// BroadcastDraw hands a single point to the hub, which sends it to everyone but the player's own connections
+func (h *Hub) BroadcastDraw(player *Player, x float64, y float64, color string, strokeWidth float64) {
+	deliver(h, h.Edits, CanvasEdit{
+		Type:   "draw",
+		Player: player,
+		Op:     CanvasOp{Points: []Point{{X: x, Y: y}}, Color: color, StrokeWidth: strokeWidth},
+	})
+}
 
-		joinEventBytes, err := json.Marshal(joinEventData)
-		if err != nil {
-			LogError("Error marshaling join event: %v", err)
-			return
-		}
+// BroadcastPath hands a finished stroke to the hub, which adds it to the history and sends it to everyone else
+func (h *Hub) BroadcastPath(player *Player, points []Point, color string, strokeWidth float64) {
+	deliver(h, h.Edits, CanvasEdit{
+		Type:   "path",
+		Player: player,
+		Op:     CanvasOp{Points: points, Color: color, StrokeWidth: strokeWidth},
+	})
+}
+
+// BroadcastFill hands a flood fill to the hub, which sends the resulting region to everyone, including the player
+// who filled, so all clients paint the server's result rather than running their own fill
+func (h *Hub) BroadcastFill(player *Player, x float64, y float64, color string) {
+	deliver(h, h.Edits, CanvasEdit{
+		Type:   "fill",
+		Player: player,
+		Op:     CanvasOp{Points: []Point{{X: x, Y: y}}, Color: color},
+	})
+}
+
+// BroadcastImagePlace puts an uploaded image on the canvas; everyone, including the player who placed it,
+// draws it when this comes back
+func (h *Hub) BroadcastImagePlace(player *Player, imageId string, x float64, y float64, scale float64, rotation float64) {
+	deliver(h, h.Edits, CanvasEdit{
+		Type:   "image",
+		Player: player,
+		Op:     CanvasOp{Points: []Point{{X: x, Y: y}}, ImageId: imageId, Scale: scale, Rotation: rotation},
+	})
+}
+
+func (h *Hub) BroadcastClear(player *Player) {
+	deliver(h, h.Edits, CanvasEdit{Type: "clear", Player: player})
+}
+
+// applyEdit changes the canvas history, records the change and sends it out, all on the hub goroutine
+func (h *Hub) applyEdit(edit CanvasEdit) {
+	if edit.Type == "load" {
+		edit.result <- h.loadCanvas(edit.Ops)
+		return
+	}
 
-		h.Broadcast <- joinEventBytes
+	player := edit.Player
+	// a player the hub already dropped, e.g. one that was just kicked, can't draw any more, and one that hasn't
+	// got a seat yet can't draw at all
+	if _, ok := h.Players[player.Conn]; !ok || !player.seated {
+		return
+	}
+	if !h.mayDraw(player) {
+		return
+	}
+
+	switch edit.Type {
+	case "draw":
+		h.applyDraw(player, edit.Op)
+	case "path":
+		h.applyPath(player, edit.Op)
+	case "fill":
+		h.applyFill(player, edit.Op)
+	case "image":
+		h.applyImagePlace(player, edit.Op)
+	case "clear":
+		h.applyClear(player)
 	}
 }
 
-func (h *Hub) BroadcastDraw(player *Player, x float64, y float64, color string, strokeWidth float64) {
-	if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
-		// Create draw event
-		drawEventData := map[string]any{
-			"type": "draw",
-			"payload": map[string]any{
-				"id":          player.Id,
-				"playerName":  player.PlayerName,
-				"playerEmoji": player.PlayerEmoji,
-				"x":           x,
-				"y":           y,
-				"color":       color,
-				"strokeWidth": strokeWidth,
-			},
-		}
+// applyDraw passes a single point on; unlike a path it isn't part of the canvas history
+func (h *Hub) applyDraw(player *Player, edit CanvasOp) {
+	point := edit.Points[0]
+	h.broadcastPlayerEvent(player, "draw", map[string]any{
+		"id":          player.Id,
+		"playerName":  player.PlayerName,
+		"playerEmoji": player.PlayerEmoji,
+		"x":           min(max(point.X, 0), float64(h.Canvas.Width)),
+		"y":           min(max(point.Y, 0), float64(h.Canvas.Height)),
+		"color":       edit.Color,
+		"strokeWidth": edit.StrokeWidth,
+	})
+}
 
-		drawEventBytes, err := json.Marshal(drawEventData)
-		if err != nil {
-			LogError("Error marshaling draw event: %v", err)
-			return
-		}
+func (h *Hub) applyPath(player *Player, edit CanvasOp) {
+	// Record the stroke so the canvas can be rendered server-side and replayed; strokes stay inside the canvas
+	op := CanvasOp{
+		Type:        "path",
+		PlayerId:    player.Id,
+		Points:      h.Canvas.Clamp(edit.Points),
+		Color:       edit.Color,
+		StrokeWidth: edit.StrokeWidth,
+		Timestamp:   time.Now(),
+	}
+	h.Canvas.Append(op)
+	h.Recorder.Record(SessionEvent{Time: op.Timestamp, Type: "op", Op: &op})
+	Stats.RecordStroke(player)
 
-		h.Broadcast <- drawEventBytes
-	}
-}
-
-func (h *Hub) BroadcastPath(player *Player, points []struct {
-	X float64 `json:"x"`
-	Y float64 `json:"y"`
-}, color string, strokeWidth float64) {
-	if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
-		// Create path event
-		pathEventData := map[string]any{
-			"type": "path",
-			"payload": map[string]any{
-				"id":          player.Id,
-				"playerName":  player.PlayerName,
-				"playerEmoji": player.PlayerEmoji,
-				"points":      points,
-				"color":       color,
-				"strokeWidth": strokeWidth,
-			},
-		}
+	pathEventBytes, err := json.Marshal(map[string]any{
+		"type": "path",
+		"payload": map[string]any{
+			"id":          player.Id,
+			"playerName":  player.PlayerName,
+			"playerEmoji": player.PlayerEmoji,
+			"points":      op.Points,
+			"color":       op.Color,
+			"strokeWidth": op.StrokeWidth,
+		},
+	})
+	if err != nil {
+		LogError("Error marshaling path event: %v", err)
+		return
+	}
 
-		pathEventBytes, err := json.Marshal(pathEventData)
-		if err != nil {
-			LogError("Error marshaling path event: %v", err)
-			return
+	// the player who drew the stroke already has it on screen
+	for _, other := range h.Players {
+		if other != player {
+			h.send(other, pathEventBytes)
 		}
+	}
+}
 
-		h.Broadcast <- pathEventBytes
+func (h *Hub) applyFill(player *Player, edit CanvasOp) {
+	seed := edit.Points[0]
+	op, ok := h.Canvas.Fill(player.Id, seed.X, seed.Y, edit.Color)
+	if !ok {
+		return
 	}
+	h.Recorder.Record(SessionEvent{Time: op.Timestamp, Type: "op", Op: &op})
+
+	h.broadcastEvent("fill", map[string]any{
+		"id":          player.Id,
+		"playerName":  player.PlayerName,
+		"playerEmoji": player.PlayerEmoji,
+		"x":           seed.X,
+		"y":           seed.Y,
+		"color":       edit.Color,
+		"spans":       op.Spans,
+	})
 }
 
-func (h *Hub) BroadcastClear(player *Player) {
-	if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
-		// Create clear event
-		clearEventData := map[string]any{
-			"type": "clear",
-			"payload": map[string]any{
-				"id":          player.Id,
-				"playerName":  player.PlayerName,
-				"playerEmoji": player.PlayerEmoji,
-			},
-		}
+func (h *Hub) applyImagePlace(player *Player, edit CanvasOp) {
+	center := h.Canvas.Clamp(edit.Points)[0]
+	op := CanvasOp{
+		Type:      "image",
+		PlayerId:  player.Id,
+		Points:    []Point{center},
+		ImageId:   edit.ImageId,
+		Scale:     edit.Scale,
+		Rotation:  math.Mod(edit.Rotation, 360),
+		Timestamp: time.Now(),
+	}
+	h.Canvas.Append(op)
+	h.Recorder.Record(SessionEvent{Time: op.Timestamp, Type: "op", Op: &op})
 
-		clearEventBytes, err := json.Marshal(clearEventData)
-		if err != nil {
-			LogError("Error marshaling clear event: %v", err)
-			return
-		}
+	h.broadcastEvent("image_place", map[string]any{
+		"id":          player.Id,
+		"playerName":  player.PlayerName,
+		"playerEmoji": player.PlayerEmoji,
+		"imageId":     op.ImageId,
+		"x":           center.X,
+		"y":           center.Y,
+		"scale":       op.Scale,
+		"rotation":    op.Rotation,
+	})
+}
+
+func (h *Hub) applyClear(player *Player) {
+	if !h.Moderation.CanClear(player.Identity) {
+		LogDebug("Ignoring clear from %s, only the host may clear", player.PlayerName)
+		IncrementModerationAction("clear_rejected")
+		return
+	}
+	// everyone shares the canvas in a prompt game, so one player can't wipe the others' drawings
+	if h.Game.Phase() == GamePhasePromptDrawing && !h.Moderation.IsHost(player.Identity) {
+		LogDebug("Ignoring clear from %s during a prompt, only the host may clear", player.PlayerName)
+		IncrementGameEvent("clear_rejected")
+		return
+	}
+
+	h.Canvas.Clear()
+	h.Recorder.Record(SessionEvent{Time: time.Now(), Type: "clear"})
 
-		h.Broadcast <- clearEventBytes
+	h.broadcastEvent("clear", map[string]any{
+		"id":          player.Id,
+		"playerName":  player.PlayerName,
+		"playerEmoji": player.PlayerEmoji,
+	})
+}
+
+// roomInfo describes the room, most importantly the canvas dimensions
+func (h *Hub) roomInfo() map[string]any {
+	settings := h.CurrentSettings()
+	return map[string]any{
+		"roomId":       h.Id,
+		"name":         settings.Name,
+		"canvasWidth":  settings.CanvasWidth,
+		"canvasHeight": settings.CanvasHeight,
+		"background":   settings.Background,
 	}
 }
+
+// SendRoomInfo tells a single player, e.g. a spectator that just connected, about the room, along with their
+// connection token and the id of their stats
+func (h *Hub) SendRoomInfo(player *Player) {
+	roomInfoData := map[string]any{
+		"type":    "room_info",
+		"payload": h.playerRoomInfo(player),
+	}
+
+	roomInfoBytes, err := json.Marshal(roomInfoData)
+	if err != nil {
+		LogError("Error marshaling room info event: %v", err)
+		return
+	}
+
+	deliver(h, h.Direct, DirectMessage{Player: player, Message: roomInfoBytes})
+}
+
+// playerRoomInfo is the room info one player is sent, with what only they may know
+func (h *Hub) playerRoomInfo(player *Player) map[string]any {
+	payload := h.roomInfo()
+	payload["token"] = player.Token
+	payload["statsId"] = StatsId(player.Identity)
+	return payload
+}
+
+func (h *Hub) canvasSyncEvent() ([]byte, error) {
+	syncEventData := map[string]any{
+		"type":    "canvas_sync",
+		"payload": h.Canvas.Document(),
+	}
+	return json.Marshal(syncEventData)
+}
+
+// SendCanvasSync sends the full canvas history to a single player, e.g. one that joined late
+func (h *Hub) SendCanvasSync(player *Player) {
+	syncEventBytes, err := h.canvasSyncEvent()
+	if err != nil {
+		LogError("Error marshaling canvas sync event: %v", err)
+		return
+	}
+
+	deliver(h, h.Direct, DirectMessage{Player: player, Message: syncEventBytes})
+}
+
+// LoadCanvas replaces the canvas history and pushes the new state to every connected player.
+// It fails with ErrGameRunning unless the room is between games.
+func (h *Hub) LoadCanvas(ops []CanvasOp) error {
+	edit := CanvasEdit{Type: "load", Ops: ops, result: make(chan error, 1)}
+	select {
+	case h.Edits <- edit:
+		return <-edit.result
+	case <-h.done:
+		return ErrRoomClosed
+	}
+}
+
+func (h *Hub) loadCanvas(ops []CanvasOp) error {
+	// the drawer-only and clear rules of a game would mean nothing if the board could be swapped under it
+	if h.Game.Phase() != GamePhaseIdle {
+		return ErrGameRunning
+	}
+
+	h.Canvas.Replace(ops)
+	h.Recorder.Record(SessionEvent{Time: time.Now(), Type: "load", Ops: ops})
+
+	syncEventBytes, err := h.canvasSyncEvent()
+	if err != nil {
+		LogError("Error marshaling canvas sync event: %v", err)
+		return nil
+	}
+	for _, player := range h.Players {
+		h.send(player, syncEventBytes)
+	}
+	return nil
+}
+
+// UpdateCursor hands a cursor position to the hub, which coalesces it with any others from the same player
+func (h *Hub) UpdateCursor(player *Player, x float64, y float64) {
+	deliver(h, h.Cursor, CursorUpdate{
+		Player: player,
+		X:      min(max(x, 0), float64(h.Canvas.Width)),
+		Y:      min(max(y, 0), float64(h.Canvas.Height)),
+	})
+}
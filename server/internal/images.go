@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register the JPEG decoder for uploads
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	MaxImageUploadBytes = 2 << 20
+	MaxImageDimension   = 2048
+	MaxImageScale       = 10
+	// every browser may upload this many images per ImageUploadWindow, and the store stops taking new images
+	// once it holds MaxStoredImageBytes
+	MaxImageUploads     = 20
+	ImageUploadWindow   = time.Hour
+	MaxStoredImageBytes = 1 << 30
+	// decoded images are kept for rendering; the cache is simply reset when it grows past this
+	maxCachedImages = 32
+)
+
+var (
+	ErrImageNotFound  = errors.New("image not found")
+	ErrUploadQuota    = errors.New("too many image uploads, try again later")
+	ErrImageStoreFull = errors.New("no more images can be stored")
+)
+
+var imageIdPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Images holds uploaded images; it is nil until InitImageStore is called, in which case image ops are not rendered
+var Images *ImageStore
+
+// ImageStore keeps uploaded images as PNG files named by the hash of their re-encoded contents,
+// so uploading the same picture twice stores it once
+type ImageStore struct {
+	mu    sync.RWMutex
+	dir   string
+	cache map[string]image.Image
+	// size is the total size of the stored files; uploads holds when each uploader's recent uploads were made
+	size    int64
+	uploads map[string][]time.Time
+}
+
+// InitImageStore sets up the shared image store in dir
+func InitImageStore(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && filepath.Ext(entry.Name()) == ".png" {
+			size += info.Size()
+		}
+	}
+	Images = &ImageStore{
+		dir:     dir,
+		cache:   make(map[string]image.Image),
+		size:    size,
+		uploads: make(map[string][]time.Time),
+	}
+	return nil
+}
+
+// UploadedImage describes a stored image
+type UploadedImage struct {
+	Id     string `json:"imageId"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Allow counts an upload by uploader, usually a browser identity, and fails once they have used up their quota
+func (s *ImageStore) Allow(uploader string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recent := s.uploads[uploader][:0]
+	for _, at := range s.uploads[uploader] {
+		if now.Sub(at) < ImageUploadWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= MaxImageUploads {
+		s.uploads[uploader] = recent
+		return ErrUploadQuota
+	}
+	s.uploads[uploader] = append(recent, now)
+
+	// forget uploaders whose uploads have all expired, so the map doesn't grow forever
+	for id, times := range s.uploads {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= ImageUploadWindow {
+			delete(s.uploads, id)
+		}
+	}
+	return nil
+}
+
+// Save validates an uploaded PNG or JPEG and stores it re-encoded as PNG.
+// Re-encoding drops metadata and anything smuggled after the image data.
+func (s *ImageStore) Save(data []byte) (UploadedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return UploadedImage{}, fmt.Errorf("unsupported image: %w", err)
+	}
+	if format != "png" && format != "jpeg" {
+		return UploadedImage{}, fmt.Errorf("unsupported image format %q", format)
+	}
+	// check the header before decoding so a tiny file can't claim a huge bitmap
+	if config.Width < 1 || config.Height < 1 || config.Width > MaxImageDimension || config.Height > MaxImageDimension {
+		return UploadedImage{}, fmt.Errorf("image must be at most %dx%d pixels", MaxImageDimension, MaxImageDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return UploadedImage{}, fmt.Errorf("decoding image: %w", err)
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return UploadedImage{}, err
+	}
+	sum := sha256.Sum256(encoded.Bytes())
+	id := hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := os.Stat(s.path(id)); errors.Is(err, os.ErrNotExist) {
+		if s.size+int64(encoded.Len()) > MaxStoredImageBytes {
+			return UploadedImage{}, ErrImageStoreFull
+		}
+		tmpPath := s.path(id) + ".tmp"
+		if err := os.WriteFile(tmpPath, encoded.Bytes(), 0644); err != nil {
+			return UploadedImage{}, err
+		}
+		if err := os.Rename(tmpPath, s.path(id)); err != nil {
+			return UploadedImage{}, err
+		}
+		s.size += int64(encoded.Len())
+	}
+	s.cacheLocked(id, img)
+
+	bounds := img.Bounds()
+	return UploadedImage{Id: id, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+func (s *ImageStore) path(id string) string {
+	return filepath.Join(s.dir, id+".png")
+}
+
+// Exists reports whether an image with the id has been uploaded
+func (s *ImageStore) Exists(id string) bool {
+	if !imageIdPattern.MatchString(id) {
+		return false
+	}
+	_, err := os.Stat(s.path(id))
+	return err == nil
+}
+
+// Path returns the file holding the PNG data of the image
+func (s *ImageStore) Path(id string) (string, error) {
+	if !s.Exists(id) {
+		return "", ErrImageNotFound
+	}
+	return s.path(id), nil
+}
+
+// Get returns the decoded image, loading it from disk the first time
+func (s *ImageStore) Get(id string) (image.Image, error) {
+	s.mu.RLock()
+	img, ok := s.cache[id]
+	s.mu.RUnlock()
+	if ok {
+		return img, nil
+	}
+
+	path, err := s.Path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, err = png.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cacheLocked(id, img)
+	s.mu.Unlock()
+	return img, nil
+}
+
+func (s *ImageStore) cacheLocked(id string, img image.Image) {
+	if len(s.cache) >= maxCachedImages {
+		clear(s.cache)
+	}
+	s.cache[id] = img
+}
+
+// ReadPNG returns the stored PNG bytes, used to embed images in SVG exports
+func (s *ImageStore) ReadPNG(id string) ([]byte, error) {
+	path, err := s.Path(id)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
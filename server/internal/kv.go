@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	kvRecordPut    byte = 1
+	kvRecordDelete byte = 2
+
+	// compact once dead records outnumber live keys by this factor
+	kvCompactRatio = 2
+)
+
+// KV is a small embedded key-value store backed by a single append-only file.
+// Every key and value is kept in memory; the file is replayed on open and rewritten by Compact.
+//
+// Record layout: crc32 (4 bytes) | kind (1 byte) | key length (uvarint) | value length (uvarint) | key | value
+type KV struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	data    map[string][]byte
+	garbage int
+}
+
+func OpenKV(path string) (*KV, error) {
+	kv := &KV{
+		path: path,
+		data: make(map[string][]byte),
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := kv.replay(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// drop a torn record left by a crash so new records are appended after the last good one
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	kv.file = file
+	return kv, nil
+}
+
+// replay loads every record into memory and returns the offset just past the last valid one
+func (kv *KV) replay(file *os.File) (int64, error) {
+	reader := bufio.NewReader(file)
+	var offset int64
+
+	for {
+		kind, key, value, size, err := readKVRecord(reader)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			LogWarning("Ignoring corrupt tail of %s at offset %d: %v", kv.path, offset, err)
+			return offset, nil
+		}
+		offset += size
+
+		if _, exists := kv.data[key]; exists {
+			kv.garbage++
+		}
+		switch kind {
+		case kvRecordPut:
+			kv.data[key] = value
+		case kvRecordDelete:
+			delete(kv.data, key)
+			kv.garbage++
+		}
+	}
+}
+
+func readKVRecord(reader *bufio.Reader) (kind byte, key string, value []byte, size int64, err error) {
+	var header [5]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("truncated record header")
+		}
+		return
+	}
+	checksum := binary.BigEndian.Uint32(header[:4])
+	kind = header[4]
+
+	keyLength, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, "", nil, 0, fmt.Errorf("reading key length: %w", err)
+	}
+	valueLength, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, "", nil, 0, fmt.Errorf("reading value length: %w", err)
+	}
+	if keyLength > 1<<16 || valueLength > 1<<30 {
+		return 0, "", nil, 0, fmt.Errorf("record lengths out of range")
+	}
+
+	body := make([]byte, keyLength+valueLength)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, "", nil, 0, fmt.Errorf("truncated record body")
+	}
+
+	lengths := binary.AppendUvarint(nil, keyLength)
+	lengths = binary.AppendUvarint(lengths, valueLength)
+	if kvChecksum(kind, lengths, body) != checksum {
+		return 0, "", nil, 0, fmt.Errorf("checksum mismatch")
+	}
+	if kind != kvRecordPut && kind != kvRecordDelete {
+		return 0, "", nil, 0, fmt.Errorf("unknown record kind %d", kind)
+	}
+
+	size = int64(len(header) + len(lengths) + len(body))
+	return kind, string(body[:keyLength]), body[keyLength:], size, nil
+}
+
+func kvChecksum(kind byte, lengths []byte, body []byte) uint32 {
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{kind})
+	crc.Write(lengths)
+	crc.Write(body)
+	return crc.Sum32()
+}
+
+func encodeKVRecord(kind byte, key string, value []byte) []byte {
+	lengths := binary.AppendUvarint(nil, uint64(len(key)))
+	lengths = binary.AppendUvarint(lengths, uint64(len(value)))
+	body := append([]byte(key), value...)
+
+	record := binary.BigEndian.AppendUint32(nil, kvChecksum(kind, lengths, body))
+	record = append(record, kind)
+	record = append(record, lengths...)
+	return append(record, body...)
+}
+
+func (kv *KV) Get(key string) ([]byte, bool) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	value, ok := kv.data[key]
+	return value, ok
+}
+
+func (kv *KV) Put(key string, value []byte) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if _, err := kv.file.Write(encodeKVRecord(kvRecordPut, key, value)); err != nil {
+		return err
+	}
+	if _, exists := kv.data[key]; exists {
+		kv.garbage++
+	}
+	kv.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (kv *KV) Delete(key string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if _, exists := kv.data[key]; !exists {
+		return nil
+	}
+	if _, err := kv.file.Write(encodeKVRecord(kvRecordDelete, key, nil)); err != nil {
+		return err
+	}
+	delete(kv.data, key)
+	kv.garbage += 2
+	return nil
+}
+
+// Keys returns every key with the given prefix in sorted order
+func (kv *KV) Keys(prefix string) []string {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	var keys []string
+	for key := range kv.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NeedsCompaction reports whether enough overwritten and deleted records have piled up to rewrite the file
+func (kv *KV) NeedsCompaction() bool {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.garbage > kvCompactRatio*len(kv.data)
+}
+
+// Compact rewrites the file with only the live keys
+func (kv *KV) Compact() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	tmpPath := kv.path + ".compact"
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	for key, value := range kv.data {
+		if _, err := writer.Write(encodeKVRecord(kvRecordPut, key, value)); err != nil {
+			tmpFile.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := os.Rename(tmpPath, kv.path); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	kv.file.Close()
+	kv.file = tmpFile
+	kv.garbage = 0
+	return nil
+}
+
+func (kv *KV) Sync() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.file.Sync()
+}
+
+func (kv *KV) Close() error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.file.Close()
+}
@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// KVCanvasStore keeps canvas history in the embedded KV store.
+// Each room has a snapshot key plus one key per logged operation, ordered by sequence number.
+type KVCanvasStore struct {
+	mu   sync.Mutex
+	kv   *KV
+	seqs map[string]uint64
+}
+
+func NewKVCanvasStore(path string) (*KVCanvasStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	kv, err := OpenKV(path)
+	if err != nil {
+		return nil, err
+	}
+	return &KVCanvasStore{
+		kv:   kv,
+		seqs: make(map[string]uint64),
+	}, nil
+}
+
+func kvSnapshotKey(roomId string) string {
+	return "canvas/" + roomId + "/snapshot"
+}
+
+func kvLogPrefix(roomId string) string {
+	return "canvas/" + roomId + "/log/"
+}
+
+// kvLogKey zero-pads the sequence number so keys sort in log order
+func kvLogKey(roomId string, seq uint64) string {
+	return fmt.Sprintf("%s%020d", kvLogPrefix(roomId), seq)
+}
+
+func (s *KVCanvasStore) Append(roomId string, op CanvasOp) error {
+	if err := validateRoomId(roomId); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seqs[roomId]++
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	return s.kv.Put(kvLogKey(roomId, s.seqs[roomId]), data)
+}
+
+func (s *KVCanvasStore) Snapshot(roomId string, ops []CanvasOp) error {
+	if err := validateRoomId(roomId); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(canvasSnapshot{Seq: s.seqs[roomId], Ops: ops})
+	if err != nil {
+		return err
+	}
+	if err := s.kv.Put(kvSnapshotKey(roomId), data); err != nil {
+		return err
+	}
+	if err := s.kv.Sync(); err != nil {
+		return err
+	}
+
+	// the snapshot covers every logged entry, so they can go
+	for _, key := range s.kv.Keys(kvLogPrefix(roomId)) {
+		if err := s.kv.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	if s.kv.NeedsCompaction() {
+		LogInfo("Compacting canvas KV store")
+		return s.kv.Compact()
+	}
+	return nil
+}
+
+func (s *KVCanvasStore) Load(roomId string) ([]CanvasOp, error) {
+	if err := validateRoomId(roomId); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshot canvasSnapshot
+	if data, ok := s.kv.Get(kvSnapshotKey(roomId)); ok {
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("reading snapshot for room %s: %w", roomId, err)
+		}
+	}
+
+	ops := snapshot.Ops
+	seq := snapshot.Seq
+
+	prefix := kvLogPrefix(roomId)
+	for _, key := range s.kv.Keys(prefix) {
+		entrySeq, err := strconv.ParseUint(key[len(prefix):], 10, 64)
+		if err != nil || entrySeq <= snapshot.Seq {
+			continue
+		}
+		data, _ := s.kv.Get(key)
+		var op CanvasOp
+		if err := json.Unmarshal(data, &op); err != nil {
+			return nil, fmt.Errorf("reading log entry %s: %w", key, err)
+		}
+		ops = append(ops, op)
+		seq = entrySeq
+	}
+
+	s.seqs[roomId] = seq
+	return ops, nil
+}
+
+func (s *KVCanvasStore) Close() error {
+	return s.kv.Close()
+}
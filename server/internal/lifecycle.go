@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultMaxRooms caps how many rooms can be open at once, the default room included
+	DefaultMaxRooms = 100
+	// RoomIdleTimeout is how long a created room may stay empty before it is closed
+	RoomIdleTimeout = 10 * time.Minute
+	// MaxRoomsCreated is how many rooms one client may create within RoomCreationWindow
+	MaxRoomsCreated    = 5
+	RoomCreationWindow = time.Hour
+)
+
+var (
+	ErrTooManyRooms = errors.New("too many rooms are open, try again later")
+	ErrRoomClosed   = errors.New("the room has been closed")
+	ErrRoomQuota    = errors.New("you have created too many rooms, try again later")
+)
+
+// RoomUpdate changes some of a room's settings and access; fields left nil stay as they are.
+// The canvas size and background are fixed once the room exists.
+type RoomUpdate struct {
+	Name         *string `json:"name"`
+	MaxPlayers   *int    `json:"maxPlayers"`
+	QueueSize    *int    `json:"queueSize"`
+	VoteMajority *int    `json:"voteMajority"`
+	VoteSeconds  *int    `json:"voteSeconds"`
+	// Teams splits the players up again; it can't change during a game
+	Teams *int `json:"teams"`
+	// Password protects the room; an empty password removes it
+	Password   *string `json:"password"`
+	InviteOnly *bool   `json:"inviteOnly"`
+	result     chan error
+}
+
+// CurrentSettings can be called from any goroutine, unlike reading Settings directly
+func (h *Hub) CurrentSettings() RoomSettings {
+	h.settingsMu.RLock()
+	defer h.settingsMu.RUnlock()
+	return h.Settings
+}
+
+// Update applies a change to the room on the hub goroutine; nothing changes if it returns an error
+func (h *Hub) Update(update RoomUpdate) error {
+	update.result = make(chan error, 1)
+	select {
+	case h.Configure <- update:
+		return <-update.result
+	case <-h.done:
+		return ErrRoomClosed
+	}
+}
+
+func (h *Hub) applyUpdate(update RoomUpdate) error {
+	settings := h.Settings
+	if update.Name != nil {
+		settings.Name = *update.Name
+	}
+	if update.MaxPlayers != nil {
+		settings.MaxPlayers = *update.MaxPlayers
+	}
+	if update.QueueSize != nil {
+		settings.QueueSize = *update.QueueSize
+	}
+	if update.VoteMajority != nil {
+		settings.VoteMajority = *update.VoteMajority
+	}
+	if update.VoteSeconds != nil {
+		settings.VoteSeconds = *update.VoteSeconds
+	}
+	if update.Teams != nil {
+		if *update.Teams != settings.Teams && h.Game.State().Phase != GamePhaseIdle {
+			return fmt.Errorf("teams can't be changed during a game")
+		}
+		settings.Teams = *update.Teams
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	// the password is the last thing that can be refused, so it goes before anything is changed
+	if update.Password != nil {
+		if err := h.Access.SetPassword(*update.Password); err != nil {
+			return err
+		}
+	}
+	if update.InviteOnly != nil {
+		h.Access.SetInviteOnly(*update.InviteOnly)
+	}
+
+	teamsChanged := settings.Teams != h.Settings.Teams
+	h.settingsMu.Lock()
+	h.Settings = settings
+	h.settingsMu.Unlock()
+	LogInfo("Room %s updated", h.Id)
+
+	if teamsChanged {
+		h.balanceTeams()
+	}
+
+	// players see the new name and limits straight away; seats freed by a higher limit are filled after this
+	h.broadcastEvent("room_info", h.roomInfo())
+	h.broadcastModeration()
+	h.sendQueuePositions()
+	h.publishSummary()
+	return nil
+}
+
+// close runs on the hub goroutine: it tells everyone why the room is going away and drops their connections
+func (h *Hub) close(reason string) {
+	LogInfo("Closing room %s: %s", h.Id, reason)
+	if h.vote != nil {
+		h.endVote("room_closed")
+	}
+	for _, player := range h.Players {
+		h.sendEvent(player, "room_closed", map[string]any{"reason": reason})
+		// everyone is leaving at once, so nobody needs to hear about the others
+		player.seated = false
+		h.removePlayer(player)
+	}
+	SetActivePlayersCount(h.Id, float64(len(h.GetActivePlayers())))
+	SetActiveSpectatorsCount(h.Id, float64(h.spectatorCount()))
+}
+
+// IsOwner reports whether token is the owner token the room was created with; the default room has no owner
+func (h *Hub) IsOwner(token string) bool {
+	return h.ownerToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.ownerToken)) == 1
+}
+
+// Create opens a new room with a random id and starts its hub; a password or inviteOnly makes it private from the start.
+// The owner token it returns lets whoever created the room change or delete it.
+// Rooms created this way close themselves after standing empty for RoomIdleTimeout.
+func (r *Rooms) Create(settings RoomSettings, password string, inviteOnly bool) (*Hub, string, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, "", err
+	}
+	access := NewRoomAccess()
+	if err := access.SetPassword(password); err != nil {
+		return nil, "", err
+	}
+	access.SetInviteOnly(inviteOnly)
+
+	r.mu.Lock()
+	if len(r.hubs) >= r.MaxRooms {
+		r.mu.Unlock()
+		return nil, "", ErrTooManyRooms
+	}
+	hub := NewHub(randomHex(6), settings)
+	hub.Access = access
+	hub.summary = hub.computeSummary()
+	hub.ownerToken = randomHex(16)
+	hub.onIdle = func() {
+		r.Remove(hub.Id, "the room was empty for too long")
+	}
+	r.hubs[hub.Id] = hub
+	r.mu.Unlock()
+
+	r.added(hub)
+	go hub.Run()
+	return hub, hub.ownerToken, nil
+}
+
+// AllowCreate counts a room created by creator, usually an address, and fails once they have used up their quota
+func (r *Rooms) AllowCreate(creator string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recent := r.created[creator][:0]
+	for _, at := range r.created[creator] {
+		if now.Sub(at) < RoomCreationWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= MaxRoomsCreated {
+		r.created[creator] = recent
+		return ErrRoomQuota
+	}
+	r.created[creator] = append(recent, now)
+
+	// forget creators whose rooms have all aged out, so the map doesn't grow forever
+	for id, times := range r.created {
+		if len(times) == 0 || now.Sub(times[len(times)-1]) >= RoomCreationWindow {
+			delete(r.created, id)
+		}
+	}
+	return nil
+}
+
+// Remove closes a room, dropping everyone in it with reason, and forgets it
+func (r *Rooms) Remove(id string, reason string) bool {
+	r.mu.Lock()
+	hub, ok := r.hubs[id]
+	delete(r.hubs, id)
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	hub.Close(reason)
+	// the hub has stopped, so nothing it published can arrive after this
+	if !hub.Summary().Private {
+		r.Lobby.Publish("room_closed", map[string]any{"id": id})
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// LobbySendBuffer is how many updates a lobby connection may fall behind before it is dropped
+const LobbySendBuffer = 64
+
+// RoomSummary is what the lobby shows about a public room
+type RoomSummary struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Players      int    `json:"players"`
+	MaxPlayers   int    `json:"maxPlayers"`
+	Spectators   int    `json:"spectators"`
+	Queued       int    `json:"queued"`
+	GamePhase    string `json:"gamePhase"`
+	Round        int    `json:"round"`
+	TotalRounds  int    `json:"totalRounds"`
+	ThumbnailUrl string `json:"thumbnailUrl"`
+	// Private rooms are left out of the lobby
+	Private bool `json:"-"`
+}
+
+// Lobby pushes room changes to everyone browsing the room list
+type Lobby struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]bool
+}
+
+func NewLobby() *Lobby {
+	return &Lobby{
+		subscribers: make(map[chan []byte]bool),
+	}
+}
+
+// Subscribe returns a channel of lobby events, closed once the subscriber is dropped
+func (l *Lobby) Subscribe() chan []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	updates := make(chan []byte, LobbySendBuffer)
+	l.subscribers[updates] = true
+	return updates
+}
+
+func (l *Lobby) Unsubscribe(updates chan []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.subscribers[updates] {
+		delete(l.subscribers, updates)
+		close(updates)
+	}
+}
+
+// Publish sends an event to every subscriber without waiting; one that can't keep up is dropped
+func (l *Lobby) Publish(eventType string, payload any) {
+	event, err := json.Marshal(map[string]any{
+		"type":    eventType,
+		"payload": payload,
+	})
+	if err != nil {
+		LogError("Error marshaling lobby event: %v", err)
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for updates := range l.subscribers {
+		select {
+		case updates <- event:
+		default:
+			LogWarning("Dropping slow lobby connection")
+			IncrementWebSocketMessageDropped("lobby")
+			delete(l.subscribers, updates)
+			close(updates)
+		}
+	}
+}
+
+// computeSummary describes the room as it is now; it runs on the hub goroutine
+func (h *Hub) computeSummary() RoomSummary {
+	g := h.Game
+	g.mu.RLock()
+	phase, round, totalRounds := g.phase, g.round, g.options.Rounds
+	g.mu.RUnlock()
+	if phase == GamePhaseIdle {
+		round, totalRounds = 0, 0
+	}
+
+	name := h.Settings.Name
+	if name == "" {
+		name = h.Id
+	}
+	return RoomSummary{
+		Id:           h.Id,
+		Name:         name,
+		Players:      len(h.joinedPlayerIds()),
+		MaxPlayers:   h.Settings.MaxPlayers,
+		Spectators:   h.spectatorCount(),
+		Queued:       len(h.queue),
+		GamePhase:    phase,
+		Round:        round,
+		TotalRounds:  totalRounds,
+		ThumbnailUrl: "/rooms/" + h.Id + "/canvas.png",
+		Private:      h.Access.Private(),
+	}
+}
+
+// Summary is the room's latest summary; unlike the hub's own state it is safe to read from any goroutine
+func (h *Hub) Summary() RoomSummary {
+	h.summaryMu.RLock()
+	defer h.summaryMu.RUnlock()
+	return h.summary
+}
+
+// publishSummary tells the lobby when the room has changed. A room going private looks like it closed,
+// and one going public like it was just created.
+func (h *Hub) publishSummary() {
+	summary := h.computeSummary()
+	h.summaryMu.Lock()
+	previous := h.summary
+	h.summary = summary
+	h.summaryMu.Unlock()
+
+	if summary == previous || h.lobby == nil {
+		return
+	}
+	switch {
+	case summary.Private && !previous.Private:
+		h.lobby.Publish("room_closed", map[string]any{"id": h.Id})
+	case !summary.Private && previous.Private:
+		h.lobby.Publish("room_created", summary)
+	case !summary.Private:
+		h.lobby.Publish("room_updated", summary)
+	}
+}
+
+// Summaries lists the public rooms, busiest first
+func (r *Rooms) Summaries() []RoomSummary {
+	summaries := []RoomSummary{}
+	for _, hub := range r.All() {
+		if summary := hub.Summary(); !summary.Private {
+			summaries = append(summaries, summary)
+		}
+	}
+	slices.SortFunc(summaries, func(a, b RoomSummary) int {
+		return cmp.Or(
+			cmp.Compare(b.Players, a.Players),
+			strings.Compare(a.Name, b.Name),
+			strings.Compare(a.Id, b.Id),
+		)
+	})
+	return summaries
+}
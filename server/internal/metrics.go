@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -55,6 +57,14 @@ var (
 		},
 	)
 
+	WebSocketMessagesDropped = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "polydraw_websocket_messages_dropped_total",
+			Help: "Total number of outgoing WebSocket messages dropped because a connection fell behind",
+		},
+		[]string{"message_type"},
+	)
+
 	WebSocketErrors = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "polydraw_websocket_errors_total",
@@ -71,6 +81,27 @@ var (
 		},
 	)
 
+	SpectatorsActive = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "polydraw_spectators_active",
+			Help: "Current number of spectator connections",
+		},
+	)
+
+	PlayersQueued = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "polydraw_players_queued",
+			Help: "Current number of players waiting for a seat in a full room",
+		},
+	)
+
+	PlayersRefusedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "polydraw_players_refused_total",
+			Help: "Total number of players turned away from a full room",
+		},
+	)
+
 	PlayersJoinedTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "polydraw_players_joined_total",
@@ -107,6 +138,28 @@ var (
 		},
 	)
 
+	FillEventsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "polydraw_fill_events_total",
+			Help: "Total number of flood fill events",
+		},
+	)
+
+	ImagePlaceEventsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "polydraw_image_place_events_total",
+			Help: "Total number of images placed on the canvas",
+		},
+	)
+
+	ImageUploadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "polydraw_image_uploads_total",
+			Help: "Total number of image uploads",
+		},
+		[]string{"result"},
+	)
+
 	ClearEventsTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "polydraw_clear_events_total",
@@ -114,6 +167,22 @@ var (
 		},
 	)
 
+	GameEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "polydraw_game_events_total",
+			Help: "Total number of game events by type",
+		},
+		[]string{"event"},
+	)
+
+	ModerationActionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "polydraw_moderation_actions_total",
+			Help: "Total number of moderation actions and rejected actions by type",
+		},
+		[]string{"action"},
+	)
+
 	PathPointsTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "polydraw_path_points_total",
@@ -166,12 +235,60 @@ func IncrementWebSocketMessageSent() {
 	WebSocketMessagesSent.Inc()
 }
 
+func IncrementWebSocketMessageDropped(messageType string) {
+	WebSocketMessagesDropped.WithLabelValues(messageType).Inc()
+}
+
 func IncrementWebSocketError(errorType string) {
 	WebSocketErrors.WithLabelValues(errorType).Inc()
 }
 
-func SetActivePlayersCount(count float64) {
-	PlayersActive.Set(count)
+// roomGauge keeps a gauge at the sum of what every room last reported, since each room only knows its own count
+type roomGauge struct {
+	gauge  prometheus.Gauge
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func newRoomGauge(gauge prometheus.Gauge) *roomGauge {
+	return &roomGauge{gauge: gauge, counts: make(map[string]float64)}
+}
+
+func (g *roomGauge) set(roomId string, count float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if count == 0 {
+		delete(g.counts, roomId)
+	} else {
+		g.counts[roomId] = count
+	}
+	total := 0.0
+	for _, c := range g.counts {
+		total += c
+	}
+	g.gauge.Set(total)
+}
+
+var (
+	playersActiveByRoom    = newRoomGauge(PlayersActive)
+	spectatorsActiveByRoom = newRoomGauge(SpectatorsActive)
+	playersQueuedByRoom    = newRoomGauge(PlayersQueued)
+)
+
+func SetActivePlayersCount(roomId string, count float64) {
+	playersActiveByRoom.set(roomId, count)
+}
+
+func SetActiveSpectatorsCount(roomId string, count float64) {
+	spectatorsActiveByRoom.set(roomId, count)
+}
+
+func SetQueuedPlayersCount(roomId string, count float64) {
+	playersQueuedByRoom.set(roomId, count)
+}
+
+func IncrementPlayerRefused() {
+	PlayersRefusedTotal.Inc()
 }
 
 func IncrementPlayerJoined() {
@@ -194,10 +311,30 @@ func IncrementPathEvent() {
 	PathEventsTotal.Inc()
 }
 
+func IncrementFillEvent() {
+	FillEventsTotal.Inc()
+}
+
+func IncrementImagePlaceEvent() {
+	ImagePlaceEventsTotal.Inc()
+}
+
+func IncrementImageUpload(result string) {
+	ImageUploadsTotal.WithLabelValues(result).Inc()
+}
+
 func IncrementClearEvent() {
 	ClearEventsTotal.Inc()
 }
 
+func IncrementGameEvent(event string) {
+	GameEventsTotal.WithLabelValues(event).Inc()
+}
+
+func IncrementModerationAction(action string) {
+	ModerationActionsTotal.WithLabelValues(action).Inc()
+}
+
 func AddPathPoints(count float64) {
 	PathPointsTotal.Add(count)
 }
@@ -0,0 +1,392 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModerationCommand is a host action or a vote.
+// TargetId names the player acted on; TargetIds is the drawing allow-list for "lock_drawing",
+// and Team the team "assign_team" moves the player to.
+type ModerationCommand struct {
+	Type      string
+	Player    *Player
+	TargetId  string
+	TargetIds []string
+	Enabled   bool
+	Password  string
+	Team      string
+	// Minutes and MaxUses describe an invite for "create_invite"
+	Minutes int
+	MaxUses int
+}
+
+// ModerationState is what every player is told about who runs the room
+type ModerationState struct {
+	HostId        string   `json:"hostId"`
+	HostOnlyClear bool     `json:"hostOnlyClear"`
+	Muted         []string `json:"muted"`
+	// DrawingLockedTo lists the only players allowed to draw; it is empty when everyone may
+	DrawingLockedTo   []string `json:"drawingLockedTo"`
+	PasswordProtected bool     `json:"passwordProtected"`
+	InviteOnly        bool     `json:"inviteOnly"`
+}
+
+// Moderation is the host role and the restrictions the host has set. Only the hub goroutine changes it;
+// the mutex lets the connection goroutines check permissions.
+// Everything is kept by browser identity rather than by the player id the client picks, so joining under
+// someone else's id doesn't make you host and rejoining under a new id doesn't lift a mute.
+type Moderation struct {
+	mu sync.RWMutex
+	// joinOrder lists the identities of the players in the room by when they arrived; the first one is the host
+	joinOrder     []string
+	hostOnlyClear bool
+	muted         map[string]bool
+	drawers       map[string]bool // nil when drawing isn't locked
+}
+
+func NewModeration() *Moderation {
+	return &Moderation{
+		muted: make(map[string]bool),
+	}
+}
+
+func (m *Moderation) IsHost(identity string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.joinOrder) > 0 && m.joinOrder[0] == identity
+}
+
+// Host returns the identity of the host, or "" in an empty room
+func (m *Moderation) Host() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.joinOrder) == 0 {
+		return ""
+	}
+	return m.joinOrder[0]
+}
+
+// CanDraw reports whether the host's drawing lock lets the player draw
+func (m *Moderation) CanDraw(identity string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.drawers == nil || m.drawers[identity]
+}
+
+// CanClear reports whether the player may wipe the canvas
+func (m *Moderation) CanClear(identity string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return !m.hostOnlyClear || (len(m.joinOrder) > 0 && m.joinOrder[0] == identity)
+}
+
+func (m *Moderation) HostOnlyClear() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.hostOnlyClear
+}
+
+func (m *Moderation) IsMuted(identity string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.muted[identity]
+}
+
+// mentions reports whether the host, the mutes or the drawing lock refer to the player
+func (m *Moderation) mentions(identity string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return (len(m.joinOrder) > 0 && m.joinOrder[0] == identity) || m.muted[identity] || m.drawers[identity]
+}
+
+// State describes the moderation in terms of player ids; playerId returns the id of the player with an identity,
+// or "" if they aren't in the room, in which case they are left out
+func (m *Moderation) State(playerId func(identity string) string) ModerationState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := ModerationState{
+		HostOnlyClear:   m.hostOnlyClear,
+		Muted:           []string{},
+		DrawingLockedTo: []string{},
+	}
+	if len(m.joinOrder) > 0 {
+		state.HostId = playerId(m.joinOrder[0])
+	}
+	for identity := range m.muted {
+		if id := playerId(identity); id != "" {
+			state.Muted = append(state.Muted, id)
+		}
+	}
+	for identity := range m.drawers {
+		if id := playerId(identity); id != "" {
+			state.DrawingLockedTo = append(state.DrawingLockedTo, id)
+		}
+	}
+	slices.Sort(state.Muted)
+	slices.Sort(state.DrawingLockedTo)
+	return state
+}
+
+// JoinOrder lists the identities of the players in the room, host first and then by when they arrived
+func (m *Moderation) JoinOrder() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.joinOrder)
+}
+
+// arrive adds a player to the end of the join order, making them host of an empty room
+func (m *Moderation) arrive(identity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.joinOrder, identity) {
+		m.joinOrder = append(m.joinOrder, identity)
+	}
+}
+
+// leave drops a player from the join order; if they were host, the longest-present player takes over
+func (m *Moderation) leave(identity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.joinOrder = slices.DeleteFunc(m.joinOrder, func(other string) bool {
+		return other == identity
+	})
+}
+
+// transfer moves a player to the front of the join order
+func (m *Moderation) transfer(identity string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.joinOrder = slices.DeleteFunc(m.joinOrder, func(other string) bool {
+		return other == identity
+	})
+	m.joinOrder = slices.Insert(m.joinOrder, 0, identity)
+}
+
+// playerArrived runs when a player gets a seat, so the first one can become host
+func (h *Hub) playerArrived(player *Player) {
+	h.Moderation.arrive(player.Identity)
+	if h.Moderation.IsHost(player.Identity) {
+		LogInfo("Player %s is the host of room %s", player.PlayerName, h.Id)
+	}
+	// a muted player who comes back under a new id is still muted, and everyone should see that
+	if h.Moderation.mentions(player.Identity) {
+		h.broadcastModeration()
+	} else {
+		h.sendEvent(player, "moderation", h.moderationState())
+	}
+	if h.vote != nil {
+		h.sendEvent(player, "vote", h.voteState())
+	}
+}
+
+// SendModeration passes a host action to the hub, which checks that the player really is the host
+func (h *Hub) SendModeration(command ModerationCommand) {
+	deliver(h, h.Moderate, command)
+}
+
+// moderationState adds who may get into the room to the host's restrictions
+func (h *Hub) moderationState() ModerationState {
+	state := h.Moderation.State(func(identity string) string {
+		if player := h.playerByIdentity(identity); player != nil {
+			return player.Id
+		}
+		return ""
+	})
+	state.PasswordProtected = h.Access.HasPassword()
+	state.InviteOnly = h.Access.InviteOnly()
+	return state
+}
+
+func (h *Hub) broadcastModeration() {
+	h.broadcastEvent("moderation", h.moderationState())
+}
+
+// playerByIdentity finds the joined player of a browser; a browser only ever has one player id in a room
+func (h *Hub) playerByIdentity(identity string) *Player {
+	for _, player := range h.Players {
+		if player.Identity == identity && player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" {
+			return player
+		}
+	}
+	return nil
+}
+
+// playerLeftModeration hands the host role on once the last connection of a player is gone
+func (h *Hub) playerLeftModeration(player *Player) {
+	if player.Id == "" || h.playerByIdentity(player.Identity) != nil {
+		return
+	}
+	delete(h.lastActive, player.Identity)
+	wasHost := h.Moderation.IsHost(player.Identity)
+	h.Moderation.leave(player.Identity)
+	if wasHost {
+		if host := h.playerByIdentity(h.Moderation.Host()); host != nil {
+			LogInfo("Host %s left room %s, %s is the new host", player.PlayerName, h.Id, host.PlayerName)
+		}
+		h.broadcastModeration()
+	}
+}
+
+func (h *Hub) handleModeration(command ModerationCommand) {
+	// bans apply to everyone, so this one isn't sent by a player
+	if command.Type == "enforce_bans" {
+		h.enforceBans()
+		return
+	}
+
+	// the player may have disconnected while the command was queued, and only players with a seat may moderate
+	if _, ok := h.Players[command.Player.Conn]; !ok || !command.Player.seated {
+		return
+	}
+
+	var err error
+	if strings.HasPrefix(command.Type, "vote_") {
+		// votes are open to every player, not just the host
+		err = h.castVote(command, time.Now())
+	} else {
+		err = h.moderate(command)
+	}
+	if err != nil {
+		LogInfo("Player %s could not %s in room %s: %v", command.Player.PlayerName, command.Type, h.Id, err)
+		h.sendEvent(command.Player, "moderation_error", map[string]any{"message": err.Error()})
+		return
+	}
+	IncrementModerationAction(command.Type)
+}
+
+// moderate carries out a host action; it runs on the hub goroutine
+func (h *Hub) moderate(command ModerationCommand) error {
+	if !h.Moderation.IsHost(command.Player.Identity) {
+		return fmt.Errorf("only the host can do that")
+	}
+
+	m := h.Moderation
+	switch command.Type {
+	case "kick":
+		if command.TargetId == command.Player.Id {
+			return fmt.Errorf("you can't kick yourself")
+		}
+		if h.playerById(command.TargetId) == nil {
+			return fmt.Errorf("that player isn't in the room")
+		}
+		h.kick(command.TargetId, "kicked by the host")
+		return nil
+	case "ban":
+		if command.TargetId == command.Player.Id {
+			return fmt.Errorf("you can't ban yourself")
+		}
+		target := h.playerById(command.TargetId)
+		if target == nil {
+			return fmt.Errorf("that player isn't in the room")
+		}
+		if Bans == nil {
+			return fmt.Errorf("bans are disabled on this server")
+		}
+		// hosts only ban the identity; an IP ban could lock out everyone behind the same address,
+		// host included, so those are left to the admin API
+		ban, err := Bans.Add(Ban{
+			Identity:  target.Identity,
+			RoomId:    h.Id,
+			Reason:    "banned by the host",
+			CreatedBy: command.Player.PlayerName,
+			ExpiresAt: time.Now().Add(HostBanDuration),
+		})
+		if err != nil {
+			LogError("Error banning player %s: %v", target.PlayerName, err)
+			return fmt.Errorf("the ban could not be saved")
+		}
+		LogInfo("Host of room %s banned %s until %s", h.Id, target.PlayerName, ban.ExpiresAt.Format(time.RFC3339))
+		h.enforceBans()
+		return nil
+	case "mute", "unmute":
+		target := h.playerById(command.TargetId)
+		if target == nil {
+			return fmt.Errorf("that player isn't in the room")
+		}
+		m.mu.Lock()
+		if command.Type == "mute" {
+			m.muted[target.Identity] = true
+		} else {
+			delete(m.muted, target.Identity)
+		}
+		m.mu.Unlock()
+	case "lock_drawing":
+		// players who aren't in the room can't be let in to draw
+		var drawers map[string]bool
+		if len(command.TargetIds) > 0 {
+			drawers = make(map[string]bool, len(command.TargetIds))
+			for _, id := range command.TargetIds {
+				if target := h.playerById(id); target != nil {
+					drawers[target.Identity] = true
+				}
+			}
+		}
+		m.mu.Lock()
+		m.drawers = drawers
+		m.mu.Unlock()
+	case "host_only_clear":
+		m.mu.Lock()
+		m.hostOnlyClear = command.Enabled
+		m.mu.Unlock()
+	case "transfer_host":
+		target := h.playerById(command.TargetId)
+		if target == nil {
+			return fmt.Errorf("that player isn't in the room")
+		}
+		LogInfo("Host of room %s passed to %s", h.Id, target.PlayerName)
+		m.transfer(target.Identity)
+	case "set_password":
+		if err := h.Access.SetPassword(command.Password); err != nil {
+			return err
+		}
+		LogInfo("Host of room %s changed its password", h.Id)
+	case "invite_only":
+		h.Access.SetInviteOnly(command.Enabled)
+	case "create_invite":
+		duration := DefaultInviteDuration
+		if command.Minutes != 0 {
+			duration = time.Duration(command.Minutes) * time.Minute
+		}
+		invite, err := NewInvite(h.Id, duration, command.MaxUses)
+		if err != nil {
+			return err
+		}
+		LogInfo("Host of room %s created invite %s", h.Id, invite.Id)
+		h.sendEvent(command.Player, "invite", map[string]any{
+			"token":     invite.Token(),
+			"expiresAt": invite.ExpiresAt,
+			"maxUses":   invite.MaxUses,
+		})
+		return nil
+	case "end_game":
+		if h.Game.State().Phase == GamePhaseIdle {
+			return fmt.Errorf("no game is running")
+		}
+		h.endGame("ended_by_host")
+		return nil
+	case "assign_team":
+		return h.moveToTeam(command.TargetId, command.Team)
+	default:
+		return fmt.Errorf("unknown action %q", command.Type)
+	}
+
+	h.broadcastModeration()
+	return nil
+}
+
+// kick tells every connection of the player why it is being closed and drops them from the room
+func (h *Hub) kick(playerId string, reason string) {
+	for _, player := range h.Players {
+		if player.Id != playerId {
+			continue
+		}
+		LogInfo("Removing player %s from room %s: %s", player.PlayerName, h.Id, reason)
+		h.sendEvent(player, "kicked", map[string]any{"reason": reason})
+		h.removePlayer(player)
+	}
+}
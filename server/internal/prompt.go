@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPromptSeconds = 120
+	MaxPromptSeconds     = 600
+	MaxThemeLength       = 64
+
+	// how long players have to vote for their favourite drawing
+	PromptVotingDuration = 30 * time.Second
+	// how long the results stay up before the next prompt
+	PromptResultsDuration = 10 * time.Second
+	// every vote a drawing gets is worth this much to whoever drew it
+	PointsPerPromptVote = 100
+
+	// the gallery keeps this many of a room's latest challenges
+	maxGalleryChallenges = 20
+)
+
+// GalleryEntry is what one player drew for a challenge
+type GalleryEntry struct {
+	PlayerId    string `json:"playerId"`
+	PlayerName  string `json:"playerName"`
+	PlayerEmoji string `json:"playerEmoji"`
+	Votes       int    `json:"votes"`
+	ImageUrl    string `json:"imageUrl"`
+	ops         []CanvasOp
+}
+
+// GalleryChallenge is the canvas as it stood when a prompt's drawing time ran out, split up by who drew what
+type GalleryChallenge struct {
+	Id         string         `json:"id"`
+	Theme      string         `json:"theme"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Background string         `json:"background"`
+	ImageUrl   string         `json:"imageUrl"`
+	Entries    []GalleryEntry `json:"entries"`
+	// Winners are the players whose drawings got the most votes; empty until voting is over or if nobody voted
+	Winners []string `json:"winners"`
+	ops     []CanvasOp
+}
+
+// Ops is the whole canvas of the challenge
+func (c GalleryChallenge) Ops() []CanvasOp {
+	return c.ops
+}
+
+// EntryOps is what one player drew for the challenge
+func (c GalleryChallenge) EntryOps(playerId string) ([]CanvasOp, bool) {
+	for _, entry := range c.Entries {
+		if entry.PlayerId == playerId {
+			return entry.ops, true
+		}
+	}
+	return nil, false
+}
+
+// Gallery keeps the drawings of a room's recent prompt challenges
+type Gallery struct {
+	mu         sync.RWMutex
+	challenges []GalleryChallenge
+	nextId     int
+}
+
+func NewGallery() *Gallery {
+	return &Gallery{}
+}
+
+// add stores a challenge, giving it an id, and forgets the oldest once the gallery is full
+func (g *Gallery) add(challenge GalleryChallenge) GalleryChallenge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nextId++
+	challenge.Id = fmt.Sprint(g.nextId)
+	g.challenges = append(g.challenges, challenge)
+	if len(g.challenges) > maxGalleryChallenges {
+		g.challenges = g.challenges[len(g.challenges)-maxGalleryChallenges:]
+	}
+	return challenge
+}
+
+// update changes a stored challenge, e.g. once its votes are in
+func (g *Gallery) update(id string, change func(*GalleryChallenge)) (GalleryChallenge, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range g.challenges {
+		if g.challenges[i].Id == id {
+			change(&g.challenges[i])
+			return g.challenges[i], true
+		}
+	}
+	return GalleryChallenge{}, false
+}
+
+// List returns the challenges, newest first
+func (g *Gallery) List() []GalleryChallenge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	challenges := slices.Clone(g.challenges)
+	slices.Reverse(challenges)
+	return challenges
+}
+
+func (g *Gallery) Get(id string) (GalleryChallenge, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	for _, challenge := range g.challenges {
+		if challenge.Id == id {
+			return challenge, true
+		}
+	}
+	return GalleryChallenge{}, false
+}
+
+// startPrompt announces the next round's theme on an empty canvas, or ends the game after the last round
+func (h *Hub) startPrompt(now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	if g.round >= g.options.Rounds {
+		g.mu.Unlock()
+		h.endGame("finished")
+		return
+	}
+	g.round++
+	theme := g.options.Theme
+	if theme == "" {
+		theme = pickWordChoices(g.words, g.used)[0]
+		g.used[theme] = true
+	}
+	g.phase = GamePhasePromptDrawing
+	g.theme = theme
+	g.challengeId = ""
+	clear(g.votes)
+	g.phaseEnds = now.Add(time.Duration(g.options.TurnSeconds) * time.Second)
+	round := g.round
+	g.mu.Unlock()
+
+	LogInfo("Round %d in room %s: everyone is drawing %q", round, h.Id, theme)
+	IncrementGameEvent("prompt_start")
+
+	h.Canvas.Clear()
+	h.Recorder.Record(SessionEvent{Time: now, Type: "clear"})
+	h.broadcastEvent("clear", map[string]any{})
+
+	h.broadcastEvent("prompt", map[string]any{"theme": theme, "round": round})
+	h.broadcastEvent("game_state", g.State())
+}
+
+// endPromptDrawing snapshots the canvas into the gallery and opens the vote. Each player still in the room who
+// drew something gets an entry; with fewer than two entries there is nothing to choose between.
+func (h *Hub) endPromptDrawing(now time.Time) {
+	g := h.Game
+	g.mu.RLock()
+	theme := g.theme
+	g.mu.RUnlock()
+
+	ops := h.Canvas.Ops()
+	imageBase := "/rooms/" + h.Id + "/gallery/"
+	challenge := GalleryChallenge{
+		Theme:      theme,
+		CreatedAt:  now,
+		Width:      h.Canvas.Width,
+		Height:     h.Canvas.Height,
+		Background: h.Canvas.Background,
+		Entries:    []GalleryEntry{},
+		Winners:    []string{},
+		ops:        ops,
+	}
+	for _, op := range ops {
+		i := slices.IndexFunc(challenge.Entries, func(entry GalleryEntry) bool {
+			return entry.PlayerId == op.PlayerId
+		})
+		if i < 0 {
+			player := h.playerById(op.PlayerId)
+			if player == nil {
+				continue
+			}
+			challenge.Entries = append(challenge.Entries, GalleryEntry{
+				PlayerId:    player.Id,
+				PlayerName:  player.PlayerName,
+				PlayerEmoji: player.PlayerEmoji,
+			})
+			i = len(challenge.Entries) - 1
+		}
+		challenge.Entries[i].ops = append(challenge.Entries[i].ops, op)
+	}
+	slices.SortFunc(challenge.Entries, func(a, b GalleryEntry) int {
+		return strings.Compare(a.PlayerName, b.PlayerName)
+	})
+
+	if len(challenge.Entries) > 0 {
+		challenge = h.Gallery.add(challenge)
+		challenge, _ = h.Gallery.update(challenge.Id, func(c *GalleryChallenge) {
+			c.ImageUrl = imageBase + c.Id + "/canvas.png"
+			for i := range c.Entries {
+				c.Entries[i].ImageUrl = imageBase + c.Id + "/entries/" + c.Entries[i].PlayerId
+			}
+		})
+	}
+
+	g.mu.Lock()
+	g.challengeId = challenge.Id
+	g.mu.Unlock()
+
+	if len(challenge.Entries) < 2 {
+		LogInfo("Not enough drawings to vote on in room %s", h.Id)
+		h.showPromptResults(challenge, now)
+		return
+	}
+
+	g.mu.Lock()
+	g.phase = GamePhasePromptVoting
+	g.phaseEnds = now.Add(PromptVotingDuration)
+	g.mu.Unlock()
+
+	IncrementGameEvent("prompt_voting")
+	h.broadcastEvent("gallery", challenge)
+	h.broadcastEvent("game_state", g.State())
+}
+
+// castPromptVote records a player's favourite drawing; players can change their vote but not vote for themselves
+func (h *Hub) castPromptVote(player *Player, entryId string, now time.Time) error {
+	g := h.Game
+	g.mu.RLock()
+	voting := g.phase == GamePhasePromptVoting
+	challengeId := g.challengeId
+	g.mu.RUnlock()
+
+	if !voting {
+		return fmt.Errorf("there is nothing to vote on right now")
+	}
+	if entryId == player.Id {
+		return fmt.Errorf("you can't vote for your own drawing")
+	}
+	challenge, _ := h.Gallery.Get(challengeId)
+	if _, ok := challenge.EntryOps(entryId); !ok {
+		return fmt.Errorf("there is no such drawing")
+	}
+
+	g.mu.Lock()
+	g.votes[player.Id] = entryId
+	voted := len(g.votes)
+	g.mu.Unlock()
+	IncrementGameEvent("prompt_vote")
+	h.sendEvent(player, "prompt_voted", map[string]any{"playerId": entryId})
+
+	// voting closes early once everyone has had their say
+	if voted >= len(h.joinedPlayerIds()) {
+		h.endPromptVoting(now)
+	}
+	return nil
+}
+
+// endPromptVoting counts the votes of the players still in the room and scores the drawings
+func (h *Hub) endPromptVoting(now time.Time) {
+	g := h.Game
+	g.mu.RLock()
+	challengeId := g.challengeId
+	counts := make(map[string]int)
+	for voterId, entryId := range g.votes {
+		if h.playerById(voterId) != nil {
+			counts[entryId]++
+		}
+	}
+	g.mu.RUnlock()
+
+	challenge, _ := h.Gallery.update(challengeId, func(c *GalleryChallenge) {
+		best := 0
+		for i := range c.Entries {
+			c.Entries[i].Votes = counts[c.Entries[i].PlayerId]
+			best = max(best, c.Entries[i].Votes)
+		}
+		if best == 0 {
+			return
+		}
+		for _, entry := range c.Entries {
+			if entry.Votes == best {
+				c.Winners = append(c.Winners, entry.PlayerId)
+			}
+		}
+	})
+
+	g.mu.Lock()
+	for _, entry := range challenge.Entries {
+		points := entry.Votes * PointsPerPromptVote
+		g.scores[entry.PlayerId] += points
+		if player := h.playerById(entry.PlayerId); player != nil {
+			g.identities[entry.PlayerId] = player.Identity
+		}
+		// team scores count points for whichever team the players are on when they score
+		if team := h.teamOf(entry.PlayerId); team != "" {
+			g.teamScores[team] += points
+		}
+	}
+	g.mu.Unlock()
+
+	h.showPromptResults(challenge, now)
+}
+
+// showPromptResults announces how the round went and pauses before the next prompt
+func (h *Hub) showPromptResults(challenge GalleryChallenge, now time.Time) {
+	g := h.Game
+	g.mu.Lock()
+	g.phase = GamePhasePromptResults
+	g.phaseEnds = now.Add(PromptResultsDuration)
+	g.mu.Unlock()
+
+	IncrementGameEvent("prompt_results")
+	h.broadcastEvent("prompt_results", challenge)
+	h.broadcastEvent("game_state", g.State())
+}
@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RenderCanvas rasterises the canvas history into an RGBA image
+func RenderCanvas(canvas *Canvas) *image.RGBA {
+	return RenderOps(canvas.Ops(), canvas.Width, canvas.Height, canvas.Background)
+}
+
+// RenderOps draws the given operations, oldest first, onto a fresh image of the given size
+func RenderOps(ops []CanvasOp, width int, height int, background string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	clearImage(img, parseColor(background))
+
+	for _, op := range ops {
+		drawOp(img, op, 1)
+	}
+
+	return img
+}
+
+func clearImage(img *image.RGBA, background color.Color) {
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+}
+
+// drawOp paints a single operation, scaling its coordinates and widths to the image
+func drawOp(img *image.RGBA, op CanvasOp, scale float64) {
+	switch op.Type {
+	case "path":
+		points := op.Points
+		if scale != 1 {
+			points = make([]Point, len(op.Points))
+			for i, p := range op.Points {
+				points[i] = Point{X: p.X * scale, Y: p.Y * scale}
+			}
+		}
+		drawStroke(img, points, parseColor(op.Color), op.StrokeWidth*scale)
+	case "fill":
+		drawSpans(img, op.Spans, parseColor(op.Color), scale)
+	case "image":
+		if Images == nil {
+			return
+		}
+		src, err := Images.Get(op.ImageId)
+		if err != nil {
+			LogError("Error loading image %s for rendering: %v", op.ImageId, err)
+			return
+		}
+		center := Point{X: op.Points[0].X * scale, Y: op.Points[0].Y * scale}
+		drawImage(img, src, center, op.Scale*scale, op.Rotation)
+	}
+}
+
+// drawImage composites src centred on center, scaled and rotated clockwise by rotation degrees.
+// Each destination pixel is mapped back into the source and sampled from the nearest source pixel.
+func drawImage(dst *image.RGBA, src image.Image, center Point, scale float64, rotation float64) {
+	bounds := src.Bounds()
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	radians := rotation * math.Pi / 180
+	cos, sin := math.Cos(radians), math.Sin(radians)
+
+	// half extents of the rotated, scaled rectangle
+	halfWidth := (math.Abs(srcWidth*scale*cos) + math.Abs(srcHeight*scale*sin)) / 2
+	halfHeight := (math.Abs(srcWidth*scale*sin) + math.Abs(srcHeight*scale*cos)) / 2
+	area := image.Rect(
+		int(math.Floor(center.X-halfWidth)),
+		int(math.Floor(center.Y-halfHeight)),
+		int(math.Ceil(center.X+halfWidth)),
+		int(math.Ceil(center.Y+halfHeight)),
+	).Intersect(dst.Bounds())
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			dx, dy := float64(x)+0.5-center.X, float64(y)+0.5-center.Y
+			u := (dx*cos+dy*sin)/scale + srcWidth/2
+			v := (-dx*sin+dy*cos)/scale + srcHeight/2
+			if u < 0 || v < 0 || u >= srcWidth || v >= srcHeight {
+				continue
+			}
+
+			sr, sg, sb, sa := src.At(bounds.Min.X+int(u), bounds.Min.Y+int(v)).RGBA()
+			if sa == 0 {
+				continue
+			}
+			// source over destination with premultiplied colours
+			i := dst.PixOffset(x, y)
+			inverse := 0xffff - sa
+			dst.Pix[i+0] = uint8((sr + uint32(dst.Pix[i+0])*0x101*inverse/0xffff) >> 8)
+			dst.Pix[i+1] = uint8((sg + uint32(dst.Pix[i+1])*0x101*inverse/0xffff) >> 8)
+			dst.Pix[i+2] = uint8((sb + uint32(dst.Pix[i+2])*0x101*inverse/0xffff) >> 8)
+			dst.Pix[i+3] = uint8((sa + uint32(dst.Pix[i+3])*0x101*inverse/0xffff) >> 8)
+		}
+	}
+}
+
+// WriteCanvasPNG encodes the rendered canvas as PNG
+func WriteCanvasPNG(w io.Writer, canvas *Canvas) error {
+	return png.Encode(w, RenderCanvas(canvas))
+}
+
+// drawStroke paints a polyline with round caps and joins, matching the client's lineCap/lineJoin settings.
+// Coverage is accumulated into a mask first so overlapping segments don't darken translucent colours.
+func drawStroke(img *image.RGBA, points []Point, c color.Color, strokeWidth float64) {
+	if len(points) == 0 {
+		return
+	}
+	if strokeWidth <= 0 {
+		strokeWidth = 1
+	}
+	radius := strokeWidth / 2
+
+	minX, minY, maxX, maxY := points[0].X, points[0].Y, points[0].X, points[0].Y
+	for _, p := range points[1:] {
+		minX = math.Min(minX, p.X)
+		minY = math.Min(minY, p.Y)
+		maxX = math.Max(maxX, p.X)
+		maxY = math.Max(maxY, p.Y)
+	}
+	bounds := image.Rect(
+		int(math.Floor(minX-radius-1)),
+		int(math.Floor(minY-radius-1)),
+		int(math.Ceil(maxX+radius+1)),
+		int(math.Ceil(maxY+radius+1)),
+	).Intersect(img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	mask := image.NewAlpha(bounds)
+	if len(points) == 1 {
+		stampSegment(mask, points[0], points[0], radius)
+	}
+	for i := 1; i < len(points); i++ {
+		stampSegment(mask, points[i-1], points[i], radius)
+	}
+
+	draw.DrawMask(img, bounds, image.NewUniform(c), image.Point{}, mask, bounds.Min, draw.Over)
+}
+
+// stampSegment marks every pixel within radius of the segment a-b, antialiased over one pixel
+func stampSegment(mask *image.Alpha, a Point, b Point, radius float64) {
+	bounds := image.Rect(
+		int(math.Floor(math.Min(a.X, b.X)-radius-1)),
+		int(math.Floor(math.Min(a.Y, b.Y)-radius-1)),
+		int(math.Ceil(math.Max(a.X, b.X)+radius+1)),
+		int(math.Ceil(math.Max(a.Y, b.Y)+radius+1)),
+	).Intersect(mask.Bounds())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := distanceToSegment(Point{X: float64(x) + 0.5, Y: float64(y) + 0.5}, a, b)
+			coverage := math.Max(0, math.Min(1, radius-d+0.5))
+			if coverage == 0 {
+				continue
+			}
+			alpha := uint8(coverage * 255)
+			if alpha > mask.AlphaAt(x, y).A {
+				mask.SetAlpha(x, y, color.Alpha{A: alpha})
+			}
+		}
+	}
+}
+
+func distanceToSegment(p Point, a Point, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / lengthSquared
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.X-(a.X+t*dx), p.Y-(a.Y+t*dy))
+}
+
+// isHexColor reports whether parseColor would accept s rather than fall back to black
+func isHexColor(s string) bool {
+	hex, ok := strings.CutPrefix(strings.TrimSpace(s), "#")
+	if !ok {
+		return false
+	}
+	switch len(hex) {
+	case 3, 4, 6, 8:
+		_, err := strconv.ParseUint(hex, 16, 32)
+		return err == nil
+	}
+	return false
+}
+
+// parseColor understands the #rgb, #rgba, #rrggbb and #rrggbbaa forms sent by the client, falling back to black
+func parseColor(s string) color.NRGBA {
+	black := color.NRGBA{A: 255}
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+
+	switch len(hex) {
+	case 3:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]}) + "ff"
+	case 4:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2], hex[3], hex[3]})
+	case 6:
+		hex += "ff"
+	case 8:
+	default:
+		return black
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return black
+	}
+	return color.NRGBA{
+		R: uint8(value >> 24),
+		G: uint8(value >> 16),
+		B: uint8(value >> 8),
+		A: uint8(value),
+	}
+}
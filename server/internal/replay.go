@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// recordings older than this many sessions are dropped
+	maxRecordedSessions = 20
+	// stop recording a session once it gets this long so a busy room can't exhaust memory
+	maxSessionEvents = 100000
+	// idle stretches are shortened to at most this long during replay
+	maxReplayGap = 2 * time.Second
+)
+
+var ReplaySpeeds = []int{1, 4, 16}
+
+// SessionEvent is a timestamped canvas change: "op" appends Op, "clear" empties the canvas, "load" replaces it with Ops
+type SessionEvent struct {
+	Time time.Time  `json:"time"`
+	Type string     `json:"type"`
+	Op   *CanvasOp  `json:"op,omitempty"`
+	Ops  []CanvasOp `json:"ops,omitempty"`
+}
+
+// Session is the recording of a room from the moment someone connects until it is empty again
+type Session struct {
+	Id         string         `json:"id"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end,omitempty"`
+	Width      int            `json:"width"`
+	Height     int            `json:"height"`
+	Background string         `json:"background"`
+	Events     []SessionEvent `json:"-"`
+}
+
+type SessionSummary struct {
+	Id         string    `json:"id"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end,omitempty"`
+	EventCount int       `json:"eventCount"`
+	Live       bool      `json:"live"`
+}
+
+// SessionRecorder keeps the canvas events of recent sessions for replay
+type SessionRecorder struct {
+	mu       sync.RWMutex
+	sessions []*Session
+	current  *Session
+	nextId   int
+}
+
+func NewSessionRecorder() *SessionRecorder {
+	return &SessionRecorder{}
+}
+
+// Begin starts a new session whose first event restores the canvas as it was at that moment
+func (r *SessionRecorder) Begin(canvas *Canvas) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.nextId++
+	r.current = &Session{
+		Id:         strconv.Itoa(r.nextId),
+		Start:      now,
+		Width:      canvas.Width,
+		Height:     canvas.Height,
+		Background: canvas.Background,
+		Events:     []SessionEvent{{Time: now, Type: "load", Ops: canvas.Ops()}},
+	}
+	r.sessions = append(r.sessions, r.current)
+	if len(r.sessions) > maxRecordedSessions {
+		r.sessions = r.sessions[len(r.sessions)-maxRecordedSessions:]
+	}
+}
+
+// End closes the current session, forgetting it if nothing was drawn
+func (r *SessionRecorder) End() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil {
+		return
+	}
+	if len(r.current.Events) <= 1 {
+		r.sessions = r.sessions[:len(r.sessions)-1]
+	} else {
+		r.current.End = time.Now()
+	}
+	r.current = nil
+}
+
+// Record adds an event to the current session; events outside a session are not recorded
+func (r *SessionRecorder) Record(event SessionEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current == nil || len(r.current.Events) >= maxSessionEvents {
+		return
+	}
+	r.current.Events = append(r.current.Events, event)
+}
+
+func (r *SessionRecorder) Summaries() []SessionSummary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	summaries := make([]SessionSummary, 0, len(r.sessions))
+	for _, session := range r.sessions {
+		summaries = append(summaries, SessionSummary{
+			Id:         session.Id,
+			Start:      session.Start,
+			End:        session.End,
+			EventCount: len(session.Events),
+			Live:       session == r.current,
+		})
+	}
+	return summaries
+}
+
+// Get returns a copy of the session with the given id, or the latest one when id is empty
+func (r *SessionRecorder) Get(id string) (Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.sessions) - 1; i >= 0; i-- {
+		session := r.sessions[i]
+		if id == "" || session.Id == id {
+			copied := *session
+			copied.Events = append([]SessionEvent(nil), session.Events...)
+			return copied, true
+		}
+	}
+	return Session{}, false
+}
+
+// replayMessage turns a recorded event into the websocket message clients already render
+func replayMessage(session Session, event SessionEvent) ([]byte, error) {
+	var eventData map[string]any
+	switch event.Type {
+	case "op":
+		payload := map[string]any{
+			"id":    event.Op.PlayerId,
+			"color": event.Op.Color,
+		}
+		messageType := event.Op.Type
+		switch event.Op.Type {
+		case "fill":
+			payload["x"] = event.Op.Points[0].X
+			payload["y"] = event.Op.Points[0].Y
+			payload["spans"] = event.Op.Spans
+		case "image":
+			messageType = "image_place"
+			payload["imageId"] = event.Op.ImageId
+			payload["x"] = event.Op.Points[0].X
+			payload["y"] = event.Op.Points[0].Y
+			payload["scale"] = event.Op.Scale
+			payload["rotation"] = event.Op.Rotation
+		default:
+			payload["points"] = event.Op.Points
+			payload["strokeWidth"] = event.Op.StrokeWidth
+		}
+		eventData = map[string]any{
+			"type":    messageType,
+			"payload": payload,
+		}
+	case "clear":
+		eventData = map[string]any{
+			"type":    "clear",
+			"payload": map[string]any{},
+		}
+	default:
+		eventData = map[string]any{
+			"type": "canvas_sync",
+			"payload": CanvasDocument{
+				Width:      session.Width,
+				Height:     session.Height,
+				Background: session.Background,
+				Ops:        event.Ops,
+			},
+		}
+	}
+	return json.Marshal(eventData)
+}
+
+// Replay re-emits the session's events with their original pacing divided by speed.
+// It returns early with the context's error when ctx is cancelled or with emit's error.
+func Replay(ctx context.Context, session Session, speed int, emit func([]byte) error) error {
+	if speed < 1 {
+		speed = 1
+	}
+
+	var previous time.Time
+	for i, event := range session.Events {
+		if i > 0 {
+			gap := event.Time.Sub(previous) / time.Duration(speed)
+			if gap > maxReplayGap {
+				gap = maxReplayGap
+			}
+			if gap > 0 {
+				timer := time.NewTimer(gap)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		previous = event.Time
+
+		message, err := replayMessage(session, event)
+		if err != nil {
+			return err
+		}
+		if err := emit(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
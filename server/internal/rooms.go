@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultRoomId = "default"
+
+	MaxCanvasWidth  = 4096
+	MaxCanvasHeight = 4096
+
+	MaxRoomNameLength = 64
+
+	// MaxPlayers of zero leaves a room unlimited; QueueSize of zero refuses players once it is full
+	DefaultMaxPlayers = 50
+	MaxRoomPlayers    = 500
+	DefaultQueueSize  = 20
+	MaxQueueSize      = 500
+
+	DefaultVoteMajority = 60
+	MinVoteMajority     = 50
+	DefaultVoteSeconds  = 30
+	MinVoteSeconds      = 10
+	MaxVoteSeconds      = 120
+)
+
+// RoomSettings are chosen when a room is created
+type RoomSettings struct {
+	// Name is shown in the lobby; the room id is used when it is empty
+	Name         string `json:"name"`
+	CanvasWidth  int    `json:"canvasWidth"`
+	CanvasHeight int    `json:"canvasHeight"`
+	Background   string `json:"background"`
+	// MaxPlayers is how many players may join; spectators don't take a seat
+	MaxPlayers int `json:"maxPlayers"`
+	// QueueSize is how many players may wait for a seat once the room is full
+	QueueSize int `json:"queueSize"`
+	// VoteMajority is the percentage of the room that must agree for a vote-kick or vote-clear to pass
+	VoteMajority int `json:"voteMajority"`
+	// VoteSeconds is how long a vote stays open
+	VoteSeconds int `json:"voteSeconds"`
+	// Teams is how many teams players are split into, or zero to play without teams
+	Teams int `json:"teams"`
+}
+
+func DefaultRoomSettings() RoomSettings {
+	return RoomSettings{
+		CanvasWidth:  DefaultCanvasWidth,
+		CanvasHeight: DefaultCanvasHeight,
+		Background:   DefaultCanvasBackground,
+		MaxPlayers:   DefaultMaxPlayers,
+		QueueSize:    DefaultQueueSize,
+		VoteMajority: DefaultVoteMajority,
+		VoteSeconds:  DefaultVoteSeconds,
+	}
+}
+
+func (s RoomSettings) Validate() error {
+	if utf8.RuneCountInString(s.Name) > MaxRoomNameLength {
+		return fmt.Errorf("room names can be at most %d characters", MaxRoomNameLength)
+	}
+	if s.CanvasWidth < 1 || s.CanvasWidth > MaxCanvasWidth {
+		return fmt.Errorf("canvas width must be between 1 and %d", MaxCanvasWidth)
+	}
+	if s.CanvasHeight < 1 || s.CanvasHeight > MaxCanvasHeight {
+		return fmt.Errorf("canvas height must be between 1 and %d", MaxCanvasHeight)
+	}
+	if !isHexColor(s.Background) {
+		return fmt.Errorf("background must be a hex colour such as #ffffff")
+	}
+	if s.MaxPlayers < 0 || s.MaxPlayers > MaxRoomPlayers {
+		return fmt.Errorf("max players must be between 0 and %d", MaxRoomPlayers)
+	}
+	if s.QueueSize < 0 || s.QueueSize > MaxQueueSize {
+		return fmt.Errorf("queue size must be between 0 and %d", MaxQueueSize)
+	}
+	if s.VoteMajority < MinVoteMajority || s.VoteMajority > 100 {
+		return fmt.Errorf("vote majority must be between %d and 100 percent", MinVoteMajority)
+	}
+	if s.VoteSeconds < MinVoteSeconds || s.VoteSeconds > MaxVoteSeconds {
+		return fmt.Errorf("votes must last between %d and %d seconds", MinVoteSeconds, MaxVoteSeconds)
+	}
+	if s.Teams != 0 && (s.Teams < MinTeams || s.Teams > MaxTeams) {
+		return fmt.Errorf("teams must be 0 or between %d and %d", MinTeams, MaxTeams)
+	}
+	return nil
+}
+
+// Rooms keeps track of every hub by its room id
+type Rooms struct {
+	mu   sync.RWMutex
+	hubs map[string]*Hub
+	// Lobby tells the room list about rooms being added, changing and closing
+	Lobby *Lobby
+	// MaxRooms limits how many rooms Create will open
+	MaxRooms int
+	// created is when each client recently created a room, for AllowCreate
+	created map[string][]time.Time
+}
+
+func NewRooms() *Rooms {
+	return &Rooms{
+		hubs:     make(map[string]*Hub),
+		Lobby:    NewLobby(),
+		MaxRooms: DefaultMaxRooms,
+		created:  make(map[string][]time.Time),
+	}
+}
+
+// Add registers a room; it must be called before the hub starts running
+func (r *Rooms) Add(hub *Hub) {
+	r.mu.Lock()
+	r.hubs[hub.Id] = hub
+	r.mu.Unlock()
+	r.added(hub)
+}
+
+// added connects a new room to the lobby
+func (r *Rooms) added(hub *Hub) {
+	hub.lobby = r.Lobby
+	if summary := hub.Summary(); !summary.Private {
+		r.Lobby.Publish("room_created", summary)
+	}
+}
+
+func (r *Rooms) Get(id string) (*Hub, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hub, ok := r.hubs[id]
+	return hub, ok
+}
+
+// All lists every room
+func (r *Rooms) All() []*Hub {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hubs := make([]*Hub, 0, len(r.hubs))
+	for _, hub := range r.hubs {
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
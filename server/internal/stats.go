@@ -0,0 +1,232 @@
+package internal
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLeaderboardSize = 20
+	MaxLeaderboardSize     = 100
+)
+
+// LeaderboardSorts are the stats the leaderboard can be ranked by
+var LeaderboardSorts = []string{"points", "wins", "gamesPlayed", "correctGuesses", "strokesDrawn"}
+
+var ErrPlayerNotFound = errors.New("player not found")
+
+// Stats holds the per-player statistics; it is nil until InitStats is called, in which case nothing is tracked
+var Stats *StatsStore
+
+// PlayerStats are the lifetime totals of a player identity
+type PlayerStats struct {
+	// Id is the StatsId of the browser identity
+	Id             string    `json:"id"`
+	PlayerName     string    `json:"playerName"`
+	PlayerEmoji    string    `json:"playerEmoji"`
+	GamesPlayed    int       `json:"gamesPlayed"`
+	Wins           int       `json:"wins"`
+	Points         int       `json:"points"`
+	CorrectGuesses int       `json:"correctGuesses"`
+	StrokesDrawn   int       `json:"strokesDrawn"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+// StatsStore keeps player stats in memory and writes the changed ones to the embedded KV store on Flush,
+// so a busy drawer doesn't cause a write per stroke
+type StatsStore struct {
+	mu    sync.RWMutex
+	kv    *KV
+	stats map[string]*PlayerStats
+	dirty map[string]bool
+}
+
+func statsKey(statsId string) string {
+	return "stats/" + statsId
+}
+
+// StatsId is the public id of a browser's stats. Stats are kept by browser identity rather than by the player id
+// the client picks, so nobody can rename or add to someone else's record; the identity itself is what the
+// browser's cookie holds, so only a hash of it is ever shown or stored.
+func StatsId(identity string) string {
+	sum := sha256.Sum256([]byte("stats:" + identity))
+	return hex.EncodeToString(sum[:12])
+}
+
+// InitStats opens the shared stats store at path, loading every player's stats
+func InitStats(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	kv, err := OpenKV(path)
+	if err != nil {
+		return err
+	}
+
+	store := &StatsStore{
+		kv:    kv,
+		stats: make(map[string]*PlayerStats),
+		dirty: make(map[string]bool),
+	}
+	for _, key := range kv.Keys("stats/") {
+		data, _ := kv.Get(key)
+		var stats PlayerStats
+		if err := json.Unmarshal(data, &stats); err != nil {
+			return fmt.Errorf("reading %s: %w", key, err)
+		}
+		store.stats[stats.Id] = &stats
+	}
+
+	LogInfo("Loaded stats for %d players", len(store.stats))
+	Stats = store
+	return nil
+}
+
+// update applies change to the player's stats, creating them on first sight
+func (s *StatsStore) update(player *Player, change func(*PlayerStats)) {
+	if s == nil || player.Identity == "" {
+		return
+	}
+	id := StatsId(player.Identity)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.stats[id]
+	if !ok {
+		stats = &PlayerStats{Id: id}
+		s.stats[id] = stats
+	}
+	if player.PlayerName != "" {
+		stats.PlayerName = player.PlayerName
+		stats.PlayerEmoji = player.PlayerEmoji
+		stats.LastSeen = time.Now()
+	}
+	change(stats)
+	s.dirty[id] = true
+}
+
+func (s *StatsStore) RecordStroke(player *Player) {
+	s.update(player, func(stats *PlayerStats) {
+		stats.StrokesDrawn++
+	})
+}
+
+func (s *StatsStore) RecordCorrectGuess(player *Player) {
+	s.update(player, func(stats *PlayerStats) {
+		stats.CorrectGuesses++
+	})
+}
+
+// RecordGame adds a game's final score to a player's totals
+func (s *StatsStore) RecordGame(player *Player, points int, won bool) {
+	s.update(player, func(stats *PlayerStats) {
+		stats.GamesPlayed++
+		stats.Points += points
+		if won {
+			stats.Wins++
+		}
+	})
+}
+
+func (s *StatsStore) Get(statsId string) (PlayerStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats, ok := s.stats[statsId]
+	if !ok {
+		return PlayerStats{}, ErrPlayerNotFound
+	}
+	return *stats, nil
+}
+
+// Leaderboard returns the top players by the given stat, ties broken by points and then name
+func (s *StatsStore) Leaderboard(sortBy string, limit int) []PlayerStats {
+	s.mu.RLock()
+	players := make([]PlayerStats, 0, len(s.stats))
+	for _, stats := range s.stats {
+		players = append(players, *stats)
+	}
+	s.mu.RUnlock()
+
+	value := func(stats PlayerStats) int {
+		switch sortBy {
+		case "wins":
+			return stats.Wins
+		case "gamesPlayed":
+			return stats.GamesPlayed
+		case "correctGuesses":
+			return stats.CorrectGuesses
+		case "strokesDrawn":
+			return stats.StrokesDrawn
+		default:
+			return stats.Points
+		}
+	}
+	slices.SortFunc(players, func(a, b PlayerStats) int {
+		return cmp.Or(
+			cmp.Compare(value(b), value(a)),
+			cmp.Compare(b.Points, a.Points),
+			cmp.Compare(a.PlayerName, b.PlayerName),
+		)
+	})
+	return players[:min(limit, len(players))]
+}
+
+// Flush writes the stats that changed since the last flush
+func (s *StatsStore) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.dirty) == 0 {
+		return
+	}
+	for id := range s.dirty {
+		data, err := json.Marshal(s.stats[id])
+		if err != nil {
+			LogError("Error marshaling stats for player %s: %v", id, err)
+			continue
+		}
+		if err := s.kv.Put(statsKey(id), data); err != nil {
+			LogError("Error writing stats for player %s: %v", id, err)
+			return
+		}
+		delete(s.dirty, id)
+	}
+	if err := s.kv.Sync(); err != nil {
+		LogError("Error syncing stats: %v", err)
+	}
+	if s.kv.NeedsCompaction() {
+		LogInfo("Compacting stats KV store")
+		if err := s.kv.Compact(); err != nil {
+			LogError("Error compacting stats: %v", err)
+		}
+	}
+}
+
+// RunFlushes flushes every interval until stop is closed, then flushes once more and closes the store
+func (s *StatsStore) RunFlushes(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-stop:
+			s.Flush()
+			if err := s.kv.Close(); err != nil {
+				LogError("Error closing stats store: %v", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// CanvasStore persists canvas history so rooms survive a restart.
+// Appends go to a log; Snapshot writes the full history and compacts the log away.
+// Load must be called for a room before appending to it, as it recovers the log position.
+type CanvasStore interface {
+	Append(roomId string, op CanvasOp) error
+	Snapshot(roomId string, ops []CanvasOp) error
+	Load(roomId string) ([]CanvasOp, error)
+	Close() error
+}
+
+// canvasSnapshot is the full history of a room up to and including log entry Seq
+type canvasSnapshot struct {
+	Seq uint64     `json:"seq"`
+	Ops []CanvasOp `json:"ops"`
+}
+
+// canvasLogEntry is a single appended operation
+type canvasLogEntry struct {
+	Seq uint64   `json:"seq"`
+	Op  CanvasOp `json:"op"`
+}
+
+var roomIdPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func validateRoomId(roomId string) error {
+	if !roomIdPattern.MatchString(roomId) {
+		return fmt.Errorf("invalid room id %q", roomId)
+	}
+	return nil
+}
+
+// OpenCanvasStore picks a backend by name: "file", "kv" or "memory" (no persistence, returns nil)
+func OpenCanvasStore(backend string, dir string) (CanvasStore, error) {
+	switch backend {
+	case "file":
+		return NewFileCanvasStore(dir)
+	case "kv":
+		return NewKVCanvasStore(filepath.Join(dir, "canvas.kv"))
+	case "memory", "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown canvas store %q", backend)
+	}
+}
+
+// FileCanvasStore keeps a snapshot file and an append-only JSON lines log per room
+type FileCanvasStore struct {
+	mu   sync.Mutex
+	dir  string
+	logs map[string]*os.File
+	seqs map[string]uint64
+}
+
+func NewFileCanvasStore(dir string) (*FileCanvasStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileCanvasStore{
+		dir:  dir,
+		logs: make(map[string]*os.File),
+		seqs: make(map[string]uint64),
+	}, nil
+}
+
+func (s *FileCanvasStore) snapshotPath(roomId string) string {
+	return filepath.Join(s.dir, roomId+".snapshot.json")
+}
+
+func (s *FileCanvasStore) logPath(roomId string) string {
+	return filepath.Join(s.dir, roomId+".log")
+}
+
+func (s *FileCanvasStore) Append(roomId string, op CanvasOp) error {
+	if err := validateRoomId(roomId); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logFile, ok := s.logs[roomId]
+	if !ok {
+		var err error
+		logFile, err = os.OpenFile(s.logPath(roomId), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.logs[roomId] = logFile
+	}
+
+	s.seqs[roomId]++
+	line, err := json.Marshal(canvasLogEntry{Seq: s.seqs[roomId], Op: op})
+	if err != nil {
+		return err
+	}
+	_, err = logFile.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileCanvasStore) Snapshot(roomId string, ops []CanvasOp) error {
+	if err := validateRoomId(roomId); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(canvasSnapshot{Seq: s.seqs[roomId], Ops: ops})
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file and rename so a crash never leaves a half written snapshot
+	tmpPath := s.snapshotPath(roomId) + ".tmp"
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.snapshotPath(roomId)); err != nil {
+		return err
+	}
+
+	// compact: everything in the log is now covered by the snapshot.
+	// Entries carry a sequence number, so a crash before this point only leaves entries Load skips.
+	if logFile, ok := s.logs[roomId]; ok {
+		logFile.Close()
+		delete(s.logs, roomId)
+	}
+	if err := os.Truncate(s.logPath(roomId), 0); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileCanvasStore) Load(roomId string) ([]CanvasOp, error) {
+	if err := validateRoomId(roomId); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snapshot canvasSnapshot
+	data, err := os.ReadFile(s.snapshotPath(roomId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("reading snapshot for room %s: %w", roomId, err)
+		}
+	}
+
+	ops := snapshot.Ops
+	seq := snapshot.Seq
+
+	logFile, err := os.Open(s.logPath(roomId))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		defer logFile.Close()
+
+		reader := bufio.NewReader(logFile)
+		var offset int64
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if readErr != nil && !errors.Is(readErr, io.EOF) {
+				return nil, readErr
+			}
+			if len(line) == 0 {
+				break
+			}
+
+			var entry canvasLogEntry
+			if readErr != nil || json.Unmarshal(line, &entry) != nil {
+				// a torn final line from a crash mid-write: drop it so later appends start on a clean line
+				LogWarning("Truncating corrupt tail of canvas log for room %s at offset %d", roomId, offset)
+				if err := os.Truncate(s.logPath(roomId), offset); err != nil {
+					return nil, err
+				}
+				break
+			}
+			offset += int64(len(line))
+
+			if entry.Seq <= snapshot.Seq {
+				continue
+			}
+			ops = append(ops, entry.Op)
+			seq = entry.Seq
+		}
+	}
+
+	s.seqs[roomId] = seq
+	return ops, nil
+}
+
+func (s *FileCanvasStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for roomId, logFile := range s.logs {
+		if err := logFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.logs, roomId)
+	}
+	return firstErr
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteCanvasSVG emits the canvas history as an SVG document, one element per operation
+func WriteCanvasSVG(w io.Writer, canvas *Canvas) error {
+	return WriteOpsSVG(w, canvas.Ops(), canvas.Width, canvas.Height, canvas.Background)
+}
+
+func WriteOpsSVG(w io.Writer, ops []CanvasOp, width int, height int, background string) error {
+	out := bufio.NewWriter(w)
+
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	fmt.Fprintf(out, `<rect width="%d" height="%d" fill="%s"/>`+"\n", width, height, svgColor(parseColor(background)))
+
+	for _, op := range ops {
+		switch op.Type {
+		case "path":
+			writeSVGPath(out, op)
+		case "fill":
+			writeSVGFill(out, op)
+		case "image":
+			writeSVGImage(out, op)
+		}
+	}
+
+	fmt.Fprint(out, "</svg>\n")
+	return out.Flush()
+}
+
+func writeSVGPath(out *bufio.Writer, op CanvasOp) {
+	if len(op.Points) == 0 {
+		return
+	}
+
+	strokeWidth := op.StrokeWidth
+	if strokeWidth <= 0 {
+		strokeWidth = 1
+	}
+
+	// A lone point becomes a zero-length segment, which round caps render as a dot
+	points := op.Points
+	if len(points) == 1 {
+		points = []Point{points[0], points[0]}
+	}
+
+	var d strings.Builder
+	for i, p := range points {
+		if i == 0 {
+			d.WriteString("M")
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(svgNumber(p.X))
+		d.WriteString(" ")
+		d.WriteString(svgNumber(p.Y))
+	}
+
+	c := parseColor(op.Color)
+	fmt.Fprintf(out, `<path d="%s" fill="none" stroke="%s"`, d.String(), svgColor(c))
+	if c.A != 255 {
+		fmt.Fprintf(out, ` stroke-opacity="%s"`, svgNumber(math.Round(float64(c.A)/255*1000)/1000))
+	}
+	fmt.Fprintf(out, ` stroke-width="%s" stroke-linecap="round" stroke-linejoin="round"/>`+"\n", svgNumber(strokeWidth))
+}
+
+// writeSVGFill draws the fill region as one path made of a one pixel high rectangle per span
+func writeSVGFill(out *bufio.Writer, op CanvasOp) {
+	if len(op.Spans) < 3 {
+		return
+	}
+
+	var d strings.Builder
+	for i := 0; i+2 < len(op.Spans); i += 3 {
+		y, x0, x1 := op.Spans[i], op.Spans[i+1], op.Spans[i+2]
+		fmt.Fprintf(&d, "M%d %dH%dV%dH%dZ", x0, y, x1, y+1, x0)
+	}
+
+	c := parseColor(op.Color)
+	fmt.Fprintf(out, `<path d="%s" fill="%s"`, d.String(), svgColor(c))
+	if c.A != 255 {
+		fmt.Fprintf(out, ` fill-opacity="%s"`, svgNumber(math.Round(float64(c.A)/255*1000)/1000))
+	}
+	fmt.Fprint(out, ` shape-rendering="crispEdges"/>`+"\n")
+}
+
+// writeSVGImage embeds the image as a data URI so the exported file stands on its own
+func writeSVGImage(out *bufio.Writer, op CanvasOp) {
+	if Images == nil {
+		return
+	}
+	data, err := Images.ReadPNG(op.ImageId)
+	if err != nil {
+		LogError("Error loading image %s for SVG export: %v", op.ImageId, err)
+		return
+	}
+	img, err := Images.Get(op.ImageId)
+	if err != nil {
+		LogError("Error loading image %s for SVG export: %v", op.ImageId, err)
+		return
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	center := op.Points[0]
+	fmt.Fprintf(out, `<image x="%s" y="%s" width="%d" height="%d" transform="translate(%s %s) rotate(%s) scale(%s)" href="data:image/png;base64,%s"/>`+"\n",
+		svgNumber(-float64(width)/2), svgNumber(-float64(height)/2), width, height,
+		svgNumber(center.X), svgNumber(center.Y), svgNumber(op.Rotation), svgNumber(op.Scale),
+		base64.StdEncoding.EncodeToString(data))
+}
+
+// svgColor formats the colour as #rrggbb; opacity is written separately since not every editor reads #rrggbbaa
+func svgColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+func svgNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
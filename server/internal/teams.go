@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	MinTeams = 2
+	MaxTeams = 4
+)
+
+// TeamNames are the teams of a room in team mode; a room with n teams uses the first n
+var TeamNames = []string{"red", "blue", "green", "yellow"}
+
+// TeamState is what every player is told about the teams: which exist and who is on each
+type TeamState struct {
+	Teams []string `json:"teams"`
+	// Members maps player ids to their team
+	Members map[string]string `json:"members"`
+}
+
+// teams lists the room's teams, none when team mode is off
+func (h *Hub) teams() []string {
+	return TeamNames[:h.Settings.Teams]
+}
+
+func (h *Hub) teamState() TeamState {
+	state := TeamState{
+		Teams:   h.teams(),
+		Members: make(map[string]string),
+	}
+	for _, player := range h.Players {
+		if player.Team != "" {
+			state.Members[player.Id] = player.Team
+		}
+	}
+	return state
+}
+
+// teamOf is the team of a joined player, or "" outside team mode
+func (h *Hub) teamOf(playerId string) string {
+	if player := h.playerById(playerId); player != nil {
+		return player.Team
+	}
+	return ""
+}
+
+// setTeam moves every connection of a player onto team
+func (h *Hub) setTeam(playerId string, team string) {
+	for _, player := range h.Players {
+		if player.Id == playerId {
+			player.Team = team
+		}
+	}
+}
+
+// smallestTeam is the team with the fewest players, the first such one on a tie
+func (h *Hub) smallestTeam() string {
+	sizes := make(map[string]int)
+	for _, id := range h.joinedPlayerIds() {
+		sizes[h.teamOf(id)]++
+	}
+	best := ""
+	for _, team := range h.teams() {
+		if best == "" || sizes[team] < sizes[best] {
+			best = team
+		}
+	}
+	return best
+}
+
+// assignTeam puts a newly seated player on a team: the one their other tabs are on, or else the smallest
+func (h *Hub) assignTeam(player *Player) {
+	if h.Settings.Teams == 0 {
+		player.Team = ""
+		return
+	}
+	for _, other := range h.Players {
+		if other != player && other.Id == player.Id && other.Team != "" {
+			player.Team = other.Team
+			return
+		}
+	}
+	player.Team = h.smallestTeam()
+}
+
+// balanceTeams deals every player out over the teams again, in the order they joined;
+// it is how players are reassigned when the number of teams changes
+func (h *Hub) balanceTeams() {
+	ids := h.joinedPlayerIds()
+	joinOrder := h.Moderation.JoinOrder()
+	position := func(id string) int {
+		if player := h.playerById(id); player != nil {
+			if i := slices.Index(joinOrder, player.Identity); i >= 0 {
+				return i
+			}
+		}
+		// seated a moment ago and not yet counted as arrived
+		return len(joinOrder)
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		return cmp.Or(cmp.Compare(position(a), position(b)), strings.Compare(a, b))
+	})
+	teams := h.teams()
+	for i, id := range ids {
+		team := ""
+		if len(teams) > 0 {
+			team = teams[i%len(teams)]
+		}
+		h.setTeam(id, team)
+	}
+	h.broadcastEvent("teams", h.teamState())
+}
+
+// moveToTeam is the host moving a player to another team
+func (h *Hub) moveToTeam(playerId string, team string) error {
+	if h.Settings.Teams == 0 {
+		return fmt.Errorf("this room doesn't play in teams")
+	}
+	if !slices.Contains(h.teams(), team) {
+		return fmt.Errorf("there is no %q team", team)
+	}
+	target := h.playerById(playerId)
+	if target == nil {
+		return fmt.Errorf("that player isn't in the room")
+	}
+	LogInfo("Host of room %s moved %s to the %s team", h.Id, target.PlayerName, team)
+	h.setTeam(playerId, team)
+	h.broadcastEvent("teams", h.teamState())
+	return nil
+}
+
+// interleaveTeams reorders player ids so turns pass from team to team, keeping the order within each team
+func interleaveTeams(ids []string, teamOf func(string) string) []string {
+	var teams []string
+	members := make(map[string][]string)
+	for _, id := range ids {
+		team := teamOf(id)
+		if _, ok := members[team]; !ok {
+			teams = append(teams, team)
+		}
+		members[team] = append(members[team], id)
+	}
+	interleaved := make([]string, 0, len(ids))
+	for len(interleaved) < len(ids) {
+		for _, team := range teams {
+			if len(members[team]) > 0 {
+				interleaved = append(interleaved, members[team][0])
+				members[team] = members[team][1:]
+			}
+		}
+	}
+	return interleaved
+}
@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/png"
+	"io"
+	"time"
+)
+
+const (
+	DefaultTimelapseInterval = time.Second
+	DefaultTimelapseDelay    = 100 * time.Millisecond
+	// longer sessions get a wider interval rather than more frames
+	MaxTimelapseFrames = 300
+	MaxTimelapseWidth  = 1200
+	MaxTimelapseHeight = 1200
+)
+
+type TimelapseOptions struct {
+	// Interval is how much session time passes between frames
+	Interval time.Duration
+	// Width of the output; the height follows the canvas aspect ratio. Zero keeps the canvas size.
+	// Tall canvases come out narrower so the height stays within MaxTimelapseHeight.
+	Width int
+	// Delay is how long each frame is shown when played back
+	Delay time.Duration
+}
+
+// renderTimelapse renders the state of the canvas every Interval of the session and hands each frame to emit as
+// soon as it is drawn, so only one frame is ever held in memory. The image is reused for the next frame.
+// Frames where nothing changed are skipped, and the last frame always shows the final state.
+func renderTimelapse(session Session, options TimelapseOptions, emit func(frame *image.RGBA) error) error {
+	if len(session.Events) == 0 {
+		return fmt.Errorf("session %s has no events", session.Id)
+	}
+
+	width, height, scale := timelapseSize(session, options.Width)
+
+	interval := options.Interval
+	if interval <= 0 {
+		interval = DefaultTimelapseInterval
+	}
+	duration := session.Events[len(session.Events)-1].Time.Sub(session.Events[0].Time)
+	if minInterval := duration / (MaxTimelapseFrames - 1); interval < minInterval {
+		interval = minInterval
+	}
+
+	background := parseColor(session.Background)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	clearImage(img, background)
+
+	frameTime := session.Events[0].Time
+	changed := false
+	emitted := 0
+
+	for _, event := range session.Events {
+		// emit a frame for every interval boundary crossed before this event
+		for event.Time.After(frameTime) {
+			if changed {
+				if err := emit(img); err != nil {
+					return err
+				}
+				emitted++
+				changed = false
+			}
+			frameTime = frameTime.Add(interval)
+		}
+
+		switch event.Type {
+		case "op":
+			drawOp(img, *event.Op, scale)
+		case "clear":
+			clearImage(img, background)
+		case "load":
+			clearImage(img, background)
+			for _, op := range event.Ops {
+				drawOp(img, op, scale)
+			}
+		}
+		changed = true
+	}
+
+	if changed || emitted == 0 {
+		return emit(img)
+	}
+	return nil
+}
+
+// timelapseSize picks the output size and scale. The longer side of a frame is capped too, so a narrow but very
+// tall canvas can't ask for a frame of millions of pixels.
+func timelapseSize(session Session, width int) (int, int, float64) {
+	if width <= 0 || width > MaxTimelapseWidth {
+		width = min(session.Width, MaxTimelapseWidth)
+	}
+	scale := float64(width) / float64(session.Width)
+	if float64(session.Height)*scale > MaxTimelapseHeight {
+		scale = MaxTimelapseHeight / float64(session.Height)
+		width = max(1, int(float64(session.Width)*scale+0.5))
+	}
+	height := max(1, min(MaxTimelapseHeight, int(float64(session.Height)*scale+0.5)))
+	return width, height, scale
+}
+
+// WriteTimelapseGIF encodes the session as a looping animated GIF. Each frame is written as soon as the next one
+// is rendered, since the final frame is held longer and that is only known once the session runs out.
+func WriteTimelapseGIF(w io.Writer, session Session, options TimelapseOptions) error {
+	delay := options.Delay
+	if delay <= 0 {
+		delay = DefaultTimelapseDelay
+	}
+	// GIF delays are in hundredths of a second
+	frameDelay := max(1, int(delay/(10*time.Millisecond)))
+
+	encoder := newGIFEncoder(w)
+	indexes := make(map[[3]uint8]uint8)
+	var pending *image.Paletted
+
+	err := renderTimelapse(session, options, func(frame *image.RGBA) error {
+		if pending == nil {
+			if err := encoder.writeHeader(frame.Bounds().Dx(), frame.Bounds().Dy()); err != nil {
+				return err
+			}
+			pending = image.NewPaletted(frame.Bounds(), palette.Plan9)
+		} else if err := encoder.writeFrame(pending, frameDelay); err != nil {
+			return err
+		}
+		toPaletted(frame, pending, indexes)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// hold the final drawing a little longer
+	if err := encoder.writeFrame(pending, frameDelay*10); err != nil {
+		return err
+	}
+	return encoder.close()
+}
+
+// toPaletted maps every pixel of frame to its nearest Plan 9 palette colour in paletted.
+// Drawings only use a handful of distinct colours, so lookups are cached across frames instead of
+// searching the palette per pixel.
+func toPaletted(frame *image.RGBA, paletted *image.Paletted, indexes map[[3]uint8]uint8) {
+	for i, j := 0, 0; i < len(frame.Pix); i, j = i+4, j+1 {
+		key := [3]uint8{frame.Pix[i], frame.Pix[i+1], frame.Pix[i+2]}
+		index, ok := indexes[key]
+		if !ok {
+			index = uint8(color.Palette(palette.Plan9).Index(color.RGBA{R: key[0], G: key[1], B: key[2], A: 255}))
+			indexes[key] = index
+		}
+		paletted.Pix[j] = index
+	}
+}
+
+// WriteTimelapseZip writes the frames as numbered PNG files in a zip archive
+func WriteTimelapseZip(w io.Writer, session Session, options TimelapseOptions) error {
+	archive := zip.NewWriter(w)
+	count := 0
+	err := renderTimelapse(session, options, func(frame *image.RGBA) error {
+		count++
+		// PNG data is already compressed, so store the files as they are
+		file, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     fmt.Sprintf("frame-%04d.png", count),
+			Method:   zip.Store,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		return png.Encode(file, frame)
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
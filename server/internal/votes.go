@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HostIdleTimeout is how long the host has to do nothing before the room may vote without them
+const HostIdleTimeout = 3 * time.Minute
+
+// Vote is a timed poll to kick a player or clear the canvas, so a room can deal with a troublemaker
+// when the host is away. Only the hub goroutine touches it.
+// Votes are counted per browser identity, so opening more tabs or making up player ids doesn't add votes.
+type Vote struct {
+	Type       string // "kick" or "clear"
+	TargetId   string
+	TargetName string
+	StartedBy  string
+	target     string // identity of the player a kick is about
+	yes        map[string]bool
+	endsAt     time.Time
+}
+
+// VoteState is the progress of the running vote as shown to every player
+type VoteState struct {
+	Type       string    `json:"type"`
+	TargetId   string    `json:"targetId,omitempty"`
+	TargetName string    `json:"targetName,omitempty"`
+	StartedBy  string    `json:"startedBy"`
+	Votes      int       `json:"votes"`
+	Needed     int       `json:"needed"`
+	EndsAt     time.Time `json:"endsAt"`
+}
+
+// joinedPlayerIds lists every joined player once, however many connections they have open
+func (h *Hub) joinedPlayerIds() []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, player := range h.Players {
+		if player.Id != "" && player.PlayerName != "" && player.PlayerEmoji != "" && !seen[player.Id] {
+			seen[player.Id] = true
+			ids = append(ids, player.Id)
+		}
+	}
+	return ids
+}
+
+// voteState counts the votes of the players still in the room against the share of the room that is needed.
+// The player a kick vote is about doesn't get a say.
+func (h *Hub) voteState() VoteState {
+	vote := h.vote
+	voters, votes := 0, 0
+	seen := make(map[string]bool)
+	for _, player := range h.Players {
+		if player.Id == "" || player.PlayerName == "" || player.PlayerEmoji == "" || seen[player.Identity] {
+			continue
+		}
+		seen[player.Identity] = true
+		if player.Identity == vote.target {
+			continue
+		}
+		voters++
+		if vote.yes[player.Identity] {
+			votes++
+		}
+	}
+	return VoteState{
+		Type:       vote.Type,
+		TargetId:   vote.TargetId,
+		TargetName: vote.TargetName,
+		StartedBy:  vote.StartedBy,
+		Votes:      votes,
+		Needed:     max(1, (voters*h.Settings.VoteMajority+99)/100),
+		EndsAt:     vote.endsAt,
+	}
+}
+
+// hostActive reports whether the room's host has done anything within HostIdleTimeout
+func (h *Hub) hostActive(now time.Time) bool {
+	host := h.Moderation.Host()
+	lastActive, ok := h.lastActive[host]
+	return host != "" && ok && now.Sub(lastActive) < HostIdleTimeout
+}
+
+// markActive notes that a player just did something; it runs on the hub goroutine
+func (h *Hub) markActive(player *Player) {
+	if player != nil && player.seated {
+		h.lastActive[player.Identity] = time.Now()
+	}
+}
+
+// checkVoteClear applies the rules of clearing the canvas by hand to a vote to clear it
+func (h *Hub) checkVoteClear() error {
+	if h.Moderation.HostOnlyClear() {
+		return fmt.Errorf("only the host may clear the canvas")
+	}
+	if h.Game.Phase() != GamePhaseIdle {
+		return fmt.Errorf("the canvas can't be cleared by vote during a game")
+	}
+	return nil
+}
+
+// castVote starts a vote, or counts the player in favour of the one already running
+func (h *Hub) castVote(command ModerationCommand, now time.Time) error {
+	voteType := strings.TrimPrefix(command.Type, "vote_")
+	if voteType == "kick" && command.TargetId == command.Player.Id {
+		return fmt.Errorf("you can't vote on kicking yourself")
+	}
+	// the room only takes matters into its own hands when the host is away
+	if h.hostActive(now) {
+		return fmt.Errorf("the host is here, ask them instead")
+	}
+	if voteType == "clear" {
+		if err := h.checkVoteClear(); err != nil {
+			return err
+		}
+	}
+
+	if h.vote != nil {
+		if h.vote.Type != voteType || h.vote.TargetId != command.TargetId {
+			return fmt.Errorf("another vote is already running")
+		}
+		if h.vote.yes[command.Player.Identity] {
+			return fmt.Errorf("you already voted")
+		}
+		h.vote.yes[command.Player.Identity] = true
+		h.updateVote()
+		return nil
+	}
+
+	vote := &Vote{
+		Type:      voteType,
+		StartedBy: command.Player.Id,
+		yes:       map[string]bool{command.Player.Identity: true},
+		endsAt:    now.Add(time.Duration(h.Settings.VoteSeconds) * time.Second),
+	}
+	if voteType == "kick" {
+		target := h.playerById(command.TargetId)
+		if target == nil {
+			return fmt.Errorf("that player isn't in the room")
+		}
+		if target.Identity == command.Player.Identity {
+			return fmt.Errorf("you can't vote on kicking yourself")
+		}
+		vote.TargetId, vote.TargetName, vote.target = target.Id, target.PlayerName, target.Identity
+	}
+
+	LogInfo("Player %s started a vote to %s in room %s", command.Player.PlayerName, voteType, h.Id)
+	h.vote = vote
+	h.updateVote()
+	return nil
+}
+
+// updateVote carries out the running vote once enough players agree, and otherwise tells everyone how it stands
+func (h *Hub) updateVote() {
+	state := h.voteState()
+	if state.Votes < state.Needed {
+		h.broadcastEvent("vote", state)
+		return
+	}
+
+	vote := h.vote
+	// a game may have started or the host may have locked clearing while the vote ran
+	if vote.Type == "clear" {
+		if err := h.checkVoteClear(); err != nil {
+			LogInfo("Vote to clear room %s can't be carried out: %v", h.Id, err)
+			h.endVote("not_allowed")
+			return
+		}
+	}
+	h.endVote("passed")
+	IncrementModerationAction("vote_passed")
+	switch vote.Type {
+	case "kick":
+		h.kick(vote.TargetId, "voted out by the room")
+	case "clear":
+		LogInfo("Room %s voted to clear the canvas", h.Id)
+		h.Canvas.Clear()
+		h.Recorder.Record(SessionEvent{Time: time.Now(), Type: "clear"})
+		h.broadcastEvent("clear", map[string]any{})
+	}
+}
+
+// endVote closes the running vote and announces why
+func (h *Hub) endVote(reason string) {
+	vote := h.vote
+	h.vote = nil
+	h.broadcastEvent("vote_end", map[string]any{
+		"type":       vote.Type,
+		"targetId":   vote.TargetId,
+		"targetName": vote.TargetName,
+		"passed":     reason == "passed",
+		"reason":     reason,
+	})
+}
+
+// tickVote lets the running vote fail once its time is up
+func (h *Hub) tickVote(now time.Time) {
+	if h.vote != nil && !now.Before(h.vote.endsAt) {
+		LogInfo("Vote to %s in room %s ran out of time", h.vote.Type, h.Id)
+		h.endVote("expired")
+	}
+}
+
+// playerLeftVote drops a kick vote whose target has gone, and otherwise recounts as the room got smaller
+func (h *Hub) playerLeftVote(player *Player) {
+	if h.vote == nil || player.Id == "" || h.playerByIdentity(player.Identity) != nil {
+		return
+	}
+	if player.Identity == h.vote.target {
+		h.endVote("target_left")
+		return
+	}
+	h.updateVote()
+}
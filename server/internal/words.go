@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// CustomWordPackId selects the words uploaded for the room itself
+	CustomWordPackId = "custom"
+	// DefaultWordPackId is the built-in pack used when no pack files are found
+	DefaultWordPackId = "default"
+
+	MaxCustomWords  = 1000
+	MaxWordLength   = 32
+	WordChoiceCount = 3
+)
+
+var wordPackIdPattern = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+
+// WordPacks holds the packs loaded at startup; it only contains the built-in pack until LoadWordPacks is called
+var WordPacks = &WordLibrary{
+	packs: map[string]*WordPack{
+		DefaultWordPackId: {
+			Id:         DefaultWordPackId,
+			Name:       "Default",
+			Category:   "mixed",
+			Language:   "en",
+			Difficulty: "easy",
+			Words:      defaultWords,
+		},
+	},
+}
+
+// WordPack is a themed list of words read from <id>.json in the words directory
+type WordPack struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Category   string   `json:"category"`
+	Language   string   `json:"language"`
+	Difficulty string   `json:"difficulty"`
+	Words      []string `json:"words"`
+}
+
+// WordPackInfo describes a pack without listing its words, which would give them away
+type WordPackInfo struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Category   string `json:"category"`
+	Language   string `json:"language"`
+	Difficulty string `json:"difficulty"`
+	WordCount  int    `json:"wordCount"`
+}
+
+// WordLibrary is the set of word packs available to every room. It is read-only once loaded.
+type WordLibrary struct {
+	packs map[string]*WordPack
+}
+
+// LoadWordPacks reads every pack in dir, keeping the built-in pack when the directory doesn't exist
+func LoadWordPacks(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		LogWarning("No word packs found in %s, using the built-in words", dir)
+		return nil
+	}
+
+	library := &WordLibrary{packs: make(map[string]*WordPack)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var pack WordPack
+		if err := json.Unmarshal(data, &pack); err != nil {
+			return fmt.Errorf("reading word pack %s: %w", path, err)
+		}
+		pack.Id = strings.TrimSuffix(filepath.Base(path), ".json")
+		if !wordPackIdPattern.MatchString(pack.Id) || pack.Id == CustomWordPackId {
+			return fmt.Errorf("word pack file %s must be named with lowercase letters, digits and dashes", path)
+		}
+		if pack.Words, err = CleanWords(pack.Words); err != nil {
+			return fmt.Errorf("word pack %s: %w", pack.Id, err)
+		}
+		if len(pack.Words) < WordChoiceCount {
+			return fmt.Errorf("word pack %s needs at least %d words", pack.Id, WordChoiceCount)
+		}
+		library.packs[pack.Id] = &pack
+	}
+
+	LogInfo("Loaded %d word packs from %s", len(library.packs), dir)
+	WordPacks = library
+	return nil
+}
+
+// Packs lists the available packs ordered by id
+func (l *WordLibrary) Packs() []WordPackInfo {
+	infos := make([]WordPackInfo, 0, len(l.packs))
+	for _, pack := range l.packs {
+		infos = append(infos, WordPackInfo{
+			Id:         pack.Id,
+			Name:       pack.Name,
+			Category:   pack.Category,
+			Language:   pack.Language,
+			Difficulty: pack.Difficulty,
+			WordCount:  len(pack.Words),
+		})
+	}
+	slices.SortFunc(infos, func(a, b WordPackInfo) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	return infos
+}
+
+// Words collects the words of the given packs, or of every pack when none are given.
+// The custom pack refers to the room's own words, passed in as custom.
+func (l *WordLibrary) Words(packIds []string, custom []string) ([]string, error) {
+	if len(packIds) == 0 {
+		for id := range l.packs {
+			packIds = append(packIds, id)
+		}
+		if len(custom) > 0 {
+			packIds = append(packIds, CustomWordPackId)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var words []string
+	for _, id := range packIds {
+		var packWords []string
+		if id == CustomWordPackId {
+			if len(custom) == 0 {
+				return nil, errors.New("this room has no custom words")
+			}
+			packWords = custom
+		} else if pack, ok := l.packs[id]; ok {
+			packWords = pack.Words
+		} else {
+			return nil, fmt.Errorf("unknown word pack %q", id)
+		}
+		for _, word := range packWords {
+			key := normalizeGuess(word)
+			if !seen[key] {
+				seen[key] = true
+				words = append(words, word)
+			}
+		}
+	}
+	if len(words) < WordChoiceCount {
+		return nil, fmt.Errorf("the selected packs need at least %d words", WordChoiceCount)
+	}
+	return words, nil
+}
+
+// CleanWords trims and de-duplicates a word list, rejecting words that can't be guessed in chat
+func CleanWords(words []string) ([]string, error) {
+	seen := make(map[string]bool)
+	cleaned := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.Join(strings.Fields(word), " ")
+		if word == "" {
+			continue
+		}
+		if utf8.RuneCountInString(word) > MaxWordLength {
+			return nil, fmt.Errorf("%q is longer than %d characters", word, MaxWordLength)
+		}
+		key := normalizeGuess(word)
+		if key == "" {
+			return nil, fmt.Errorf("%q has no letters or digits", word)
+		}
+		if !seen[key] {
+			seen[key] = true
+			cleaned = append(cleaned, word)
+		}
+	}
+	return cleaned, nil
+}
+
+// pickWordChoices draws distinct words that haven't been played yet this game.
+// Once nearly every word has been used the history is forgotten rather than running out.
+func pickWordChoices(words []string, used map[string]bool) []string {
+	var fresh []string
+	for _, word := range words {
+		if !used[word] {
+			fresh = append(fresh, word)
+		}
+	}
+	if len(fresh) < WordChoiceCount {
+		clear(used)
+		fresh = slices.Clone(words)
+	}
+	rand.Shuffle(len(fresh), func(i, j int) {
+		fresh[i], fresh[j] = fresh[j], fresh[i]
+	})
+	return fresh[:min(WordChoiceCount, len(fresh))]
+}
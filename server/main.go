@@ -3,14 +3,31 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"server/internal"
 	"server/ws"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const PORT = ":8080"
 
+// how often dirty canvases are snapshotted and their logs compacted, and changed player stats are written
+const SNAPSHOT_INTERVAL = 30 * time.Second
+
+// getEnv reads an environment variable, falling back to a default when it is unset
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
 func main() {
 	// Initialize logger
 	if err := internal.InitLogger(); err != nil {
@@ -19,11 +36,143 @@ func main() {
 
 	internal.LogInfo("Starting Polydraw server...")
 
-	hub := internal.NewHub()
+	// Open the canvas store: "file" (default), "kv" or "memory"
+	dataDir := getEnv("DATA_DIR", "data")
+	store, err := internal.OpenCanvasStore(getEnv("CANVAS_STORE", "file"), dataDir)
+	if err != nil {
+		log.Fatal("Failed to open canvas store:", err)
+	}
+
+	// Uploaded images are always kept on disk, whatever the canvas store
+	if err := internal.InitImageStore(filepath.Join(dataDir, "images")); err != nil {
+		log.Fatal("Failed to initialize image store:", err)
+	}
+
+	// Player stats are always kept on disk too
+	if err := internal.InitStats(filepath.Join(dataDir, "stats.kv")); err != nil {
+		log.Fatal("Failed to open player stats:", err)
+	}
+	statsDone := make(chan struct{})
+
+	// So are bans, which the admin API manages when ADMIN_TOKEN is set
+	if err := internal.InitBans(filepath.Join(dataDir, "bans.kv")); err != nil {
+		log.Fatal("Failed to open ban list:", err)
+	}
+	internal.AdminToken = getEnv("ADMIN_TOKEN", "")
+
+	// Invite links only survive a restart when they are signed with a configured secret
+	if secret := getEnv("INVITE_SECRET", ""); secret != "" {
+		internal.InviteSecret = []byte(secret)
+	} else {
+		internal.LogWarning("INVITE_SECRET is not set, invite links will stop working when the server restarts")
+	}
+
+	// Word packs for games; the built-in words are used when the directory is empty
+	if err := internal.LoadWordPacks(getEnv("WORDS_DIR", "words")); err != nil {
+		log.Fatal("Failed to load word packs:", err)
+	}
+
+	// Canvas size and background of the default room
+	settings := internal.DefaultRoomSettings()
+	settings.CanvasWidth, err = strconv.Atoi(getEnv("CANVAS_WIDTH", strconv.Itoa(settings.CanvasWidth)))
+	if err != nil {
+		log.Fatal("Invalid CANVAS_WIDTH:", err)
+	}
+	settings.CanvasHeight, err = strconv.Atoi(getEnv("CANVAS_HEIGHT", strconv.Itoa(settings.CanvasHeight)))
+	if err != nil {
+		log.Fatal("Invalid CANVAS_HEIGHT:", err)
+	}
+	settings.Background = getEnv("CANVAS_BACKGROUND", settings.Background)
+	settings.Name = getEnv("ROOM_NAME", "Polydraw")
+	// How many players fit in the room, and how many may wait for a seat when it is full
+	settings.MaxPlayers, err = strconv.Atoi(getEnv("MAX_PLAYERS", strconv.Itoa(settings.MaxPlayers)))
+	if err != nil {
+		log.Fatal("Invalid MAX_PLAYERS:", err)
+	}
+	settings.QueueSize, err = strconv.Atoi(getEnv("QUEUE_SIZE", strconv.Itoa(settings.QueueSize)))
+	if err != nil {
+		log.Fatal("Invalid QUEUE_SIZE:", err)
+	}
+	// Share of the room needed to pass a vote-kick or vote-clear, in percent, and how long votes stay open
+	settings.VoteMajority, err = strconv.Atoi(getEnv("VOTE_MAJORITY", strconv.Itoa(settings.VoteMajority)))
+	if err != nil {
+		log.Fatal("Invalid VOTE_MAJORITY:", err)
+	}
+	settings.VoteSeconds, err = strconv.Atoi(getEnv("VOTE_SECONDS", strconv.Itoa(settings.VoteSeconds)))
+	if err != nil {
+		log.Fatal("Invalid VOTE_SECONDS:", err)
+	}
+	// Team mode splits the players into this many teams; zero plays without teams
+	settings.Teams, err = strconv.Atoi(getEnv("TEAMS", strconv.Itoa(settings.Teams)))
+	if err != nil {
+		log.Fatal("Invalid TEAMS:", err)
+	}
+	if err := settings.Validate(); err != nil {
+		log.Fatal("Invalid room settings:", err)
+	}
+
+	rooms := internal.NewRooms()
+	// Rooms beyond the default one are created through the API, up to this many in all
+	rooms.MaxRooms, err = strconv.Atoi(getEnv("MAX_ROOMS", strconv.Itoa(rooms.MaxRooms)))
+	if err != nil || rooms.MaxRooms < 1 {
+		log.Fatal("Invalid MAX_ROOMS:", getEnv("MAX_ROOMS", ""))
+	}
+	hub := internal.NewHub(internal.DefaultRoomId, settings)
+	rooms.Add(hub)
+
+	// The default room can be made private from the start
+	if password := getEnv("ROOM_PASSWORD", ""); password != "" {
+		if err := hub.Access.SetPassword(password); err != nil {
+			log.Fatal("Invalid ROOM_PASSWORD:", err)
+		}
+	}
+
+	stopSnapshots := make(chan struct{})
+	snapshotsDone := make(chan struct{})
+	if store != nil {
+		// reload whatever was drawn before the last restart
+		if err := hub.Canvas.Persist(hub.Id, store); err != nil {
+			log.Fatal("Failed to restore canvas:", err)
+		}
+		internal.LogInfo("Restored %d canvas ops for room %s", len(hub.Canvas.Ops()), hub.Id)
+
+		go func() {
+			hub.Canvas.RunSnapshots(SNAPSHOT_INTERVAL, stopSnapshots)
+			close(snapshotsDone)
+		}()
+	} else {
+		close(snapshotsDone)
+	}
+
+	go func() {
+		internal.Stats.RunFlushes(SNAPSHOT_INTERVAL, stopSnapshots)
+		close(statsDone)
+	}()
 
 	// hub runs in its own goroutine
 	go hub.Run()
 
+	// Take a final snapshot before exiting so the log doesn't have to be replayed on the next start
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		internal.LogInfo("Shutting down Polydraw server...")
+		close(stopSnapshots)
+		<-snapshotsDone
+		<-statsDone
+		if err := internal.Bans.Close(); err != nil {
+			internal.LogError("Error closing ban list: %v", err)
+		}
+		if store != nil {
+			if err := store.Close(); err != nil {
+				internal.LogError("Error closing canvas store: %v", err)
+			}
+		}
+		os.Exit(0)
+	}()
+
 	// Add Prometheus metrics endpoint
 	http.Handle("/metrics", promhttp.Handler())
 
@@ -34,7 +183,7 @@ func main() {
 
 	http.HandleFunc("/ws", internal.InstrumentedHandler("/ws", func(w http.ResponseWriter, r *http.Request) {
 		internal.LogDebug("WebSocket connection request from %s", r.RemoteAddr)
-		ws.HandleWebSocket(w, r, hub)
+		ws.HandleWebSocket(w, r, rooms)
 	}))
 
 	http.HandleFunc("/players", internal.InstrumentedHandler("/players", func(w http.ResponseWriter, r *http.Request) {
@@ -42,8 +191,123 @@ func main() {
 		ws.HandleGetPlayers(w, r, hub)
 	}))
 
+	http.HandleFunc("/rooms/{id}", internal.InstrumentedHandler("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Room %s %s request from %s", r.PathValue("id"), r.Method, r.RemoteAddr)
+		ws.HandleRoom(w, r, rooms)
+	}))
+
+	http.HandleFunc("/players/{id}/stats", internal.InstrumentedHandler("/players/{id}/stats", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Stats request for player %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGetPlayerStats(w, r)
+	}))
+
+	http.HandleFunc("/leaderboard", internal.InstrumentedHandler("/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Leaderboard request from %s", r.RemoteAddr)
+		ws.HandleLeaderboard(w, r)
+	}))
+
+	http.HandleFunc("/rooms", internal.InstrumentedHandler("/rooms", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Rooms %s request from %s", r.Method, r.RemoteAddr)
+		ws.HandleRooms(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/players", internal.InstrumentedHandler("/rooms/{id}/players", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Players list request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGetRoomPlayers(w, r, rooms)
+	}))
+
+	http.HandleFunc("/lobby", internal.InstrumentedHandler("/lobby", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Lobby connection request from %s", r.RemoteAddr)
+		ws.HandleLobby(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/canvas", internal.InstrumentedHandler("/rooms/{id}/canvas", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Canvas %s request for room %s from %s", r.Method, r.PathValue("id"), r.RemoteAddr)
+		ws.HandleCanvas(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/canvas.png", internal.InstrumentedHandler("/rooms/{id}/canvas.png", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Canvas PNG request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleCanvasPNG(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/canvas.svg", internal.InstrumentedHandler("/rooms/{id}/canvas.svg", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Canvas SVG request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleCanvasSVG(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/gallery", internal.InstrumentedHandler("/rooms/{id}/gallery", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Gallery request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGetGallery(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/gallery/{challengeId}/canvas.png", internal.InstrumentedHandler("/rooms/{id}/gallery/{challengeId}/canvas.png", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Gallery PNG request for challenge %s of room %s from %s", r.PathValue("challengeId"), r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGalleryPNG(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/gallery/{challengeId}/entries/{playerId}", internal.InstrumentedHandler("/rooms/{id}/gallery/{challengeId}/entries/{playerId}", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Gallery entry request for challenge %s of room %s from %s", r.PathValue("challengeId"), r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGalleryPNG(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/sessions", internal.InstrumentedHandler("/rooms/{id}/sessions", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Sessions list request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleGetSessions(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/replay", internal.InstrumentedHandler("/rooms/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Replay request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleReplay(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/timelapse.gif", internal.InstrumentedHandler("/rooms/{id}/timelapse.gif", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Timelapse GIF request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleTimelapse(w, r, rooms, "gif")
+	}))
+
+	http.HandleFunc("/rooms/{id}/timelapse.zip", internal.InstrumentedHandler("/rooms/{id}/timelapse.zip", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Timelapse frames request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleTimelapse(w, r, rooms, "zip")
+	}))
+
+	http.HandleFunc("/wordpacks", internal.InstrumentedHandler("/wordpacks", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Word packs request from %s", r.RemoteAddr)
+		ws.HandleGetWordPacks(w, r)
+	}))
+
+	http.HandleFunc("/rooms/{id}/words", internal.InstrumentedHandler("/rooms/{id}/words", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Custom words %s request for room %s from %s", r.Method, r.PathValue("id"), r.RemoteAddr)
+		ws.HandleRoomWords(w, r, rooms)
+	}))
+
+	http.HandleFunc("/rooms/{id}/images", internal.InstrumentedHandler("/rooms/{id}/images", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Image upload request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleImageUpload(w, r, rooms)
+	}))
+
+	http.HandleFunc("/images/{imageId}", internal.InstrumentedHandler("/images/{imageId}", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Image %s request from %s", r.PathValue("imageId"), r.RemoteAddr)
+		ws.HandleGetImage(w, r)
+	}))
+
+	http.HandleFunc("/admin/bans", internal.InstrumentedHandler("/admin/bans", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Bans %s request from %s", r.Method, r.RemoteAddr)
+		ws.HandleBans(w, r, rooms)
+	}))
+
+	http.HandleFunc("/admin/bans/{banId}", internal.InstrumentedHandler("/admin/bans/{banId}", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Ban %s %s request from %s", r.PathValue("banId"), r.Method, r.RemoteAddr)
+		ws.HandleBan(w, r)
+	}))
+
+	http.HandleFunc("/admin/rooms/{id}/invites", internal.InstrumentedHandler("/admin/rooms/{id}/invites", func(w http.ResponseWriter, r *http.Request) {
+		internal.LogDebug("Invite request for room %s from %s", r.PathValue("id"), r.RemoteAddr)
+		ws.HandleCreateInvite(w, r, rooms)
+	}))
+
 	internal.LogInfo("Server is running on port %s", PORT)
-	err := http.ListenAndServe(PORT, nil)
+	err = http.ListenAndServe(PORT, nil)
 
 	if err != nil {
 		internal.LogError("Server failed to start: %v", err)
@@ -0,0 +1,226 @@
+package ws
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/internal"
+	"strings"
+	"time"
+)
+
+// BanRequest is the body of POST /admin/bans
+type BanRequest struct {
+	Identity string `json:"identity"`
+	IP       string `json:"ip"`
+	RoomId   string `json:"roomId"`
+	Reason   string `json:"reason"`
+	// Minutes is how long the ban lasts; zero bans until the ban is lifted
+	Minutes int `json:"minutes"`
+}
+
+func isAdminToken(token string) bool {
+	return internal.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(internal.AdminToken)) == 1
+}
+
+// checkAdmin answers the request itself unless it carries the admin token as a bearer token
+func checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if internal.AdminToken == "" {
+		http.Error(w, "The admin API is disabled", http.StatusServiceUnavailable)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !isAdminToken(token) {
+		internal.LogWarning("Rejected admin request from %s", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// HandleBans lists the bans in force (GET) or adds one (POST), dropping anyone it applies to
+func HandleBans(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, POST, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	if internal.Bans == nil {
+		http.Error(w, "Bans are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(internal.Bans.List()); err != nil {
+			internal.LogError("Error encoding bans response: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var request BanRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&request); err != nil {
+		http.Error(w, "Invalid ban", http.StatusBadRequest)
+		return
+	}
+	if request.Minutes < 0 {
+		http.Error(w, "Minutes must not be negative", http.StatusBadRequest)
+		return
+	}
+	if request.RoomId != "" {
+		if _, ok := rooms.Get(request.RoomId); !ok {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	ban := internal.Ban{
+		Identity:  request.Identity,
+		IP:        request.IP,
+		RoomId:    request.RoomId,
+		Reason:    request.Reason,
+		CreatedBy: "admin",
+	}
+	if ban.Reason == "" {
+		ban.Reason = "banned by an administrator"
+	}
+	if request.Minutes > 0 {
+		ban.ExpiresAt = time.Now().Add(time.Duration(request.Minutes) * time.Minute)
+	}
+	ban, err := internal.Bans.Add(ban)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	internal.LogInfo("Admin banned identity %q ip %q from %s: %s", ban.Identity, ban.IP, r.RemoteAddr, ban.Reason)
+	internal.IncrementModerationAction("admin_ban")
+
+	for _, hub := range rooms.All() {
+		hub.EnforceBans()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(ban); err != nil {
+		internal.LogError("Error encoding ban response: %v", err)
+	}
+}
+
+// HandleBan lifts a ban
+func HandleBan(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, "DELETE, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	if internal.Bans == nil {
+		http.Error(w, "Bans are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	banId := r.PathValue("banId")
+	if err := internal.Bans.Remove(banId); err != nil {
+		if errors.Is(err, internal.ErrBanNotFound) {
+			http.Error(w, "Ban not found", http.StatusNotFound)
+			return
+		}
+		internal.LogError("Error lifting ban %s: %v", banId, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	internal.LogInfo("Admin lifted ban %s from %s", banId, r.RemoteAddr)
+	internal.IncrementModerationAction("admin_unban")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// InviteRequest is the body of POST /admin/rooms/{id}/invites
+type InviteRequest struct {
+	// Minutes is how long the invite lasts, a day when zero
+	Minutes int `json:"minutes"`
+	// MaxUses limits how many browsers can join with the invite; zero means no limit
+	MaxUses int `json:"maxUses"`
+}
+
+// HandleCreateInvite signs an invite token for a room
+func HandleCreateInvite(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "POST, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !checkAdmin(w, r) {
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	var request InviteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid invite", http.StatusBadRequest)
+		return
+	}
+	duration := internal.DefaultInviteDuration
+	if request.Minutes != 0 {
+		duration = time.Duration(request.Minutes) * time.Minute
+	}
+	invite, err := internal.NewInvite(hub.Id, duration, request.MaxUses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	internal.LogInfo("Admin created invite %s to room %s from %s", invite.Id, hub.Id, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"token":     invite.Token(),
+		"roomId":    invite.RoomId,
+		"expiresAt": invite.ExpiresAt,
+		"maxUses":   invite.MaxUses,
+	}); err != nil {
+		internal.LogError("Error encoding invite response: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/internal"
+)
+
+// setCORSHeaders allows the browser client, served from another origin, to call the HTTP API
+func setCORSHeaders(w http.ResponseWriter, methods string) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
+}
+
+func HandleCanvasPNG(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := internal.WriteCanvasPNG(w, hub.Canvas); err != nil {
+		internal.LogError("Error encoding canvas PNG for room %s: %v", hub.Id, err)
+		return
+	}
+}
+
+func HandleCanvasSVG(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := internal.WriteCanvasSVG(w, hub.Canvas); err != nil {
+		internal.LogError("Error writing canvas SVG for room %s: %v", hub.Id, err)
+		return
+	}
+}
+
+// maxCanvasImportBytes caps the size of an uploaded canvas document
+const maxCanvasImportBytes = 10 << 20
+
+// HandleCanvas exports the room canvas as JSON on GET and imports a previously exported document on POST.
+// Importing takes the room's owner token or the admin token and is refused while a game is running.
+func HandleCanvas(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, POST, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if !checkRoomAccess(w, r, hub) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := json.NewEncoder(w).Encode(hub.Canvas.Document()); err != nil {
+			internal.LogError("Error encoding canvas for room %s: %v", hub.Id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	case "POST":
+		// an import replaces the whole board, so it takes the same token as managing the room
+		if !checkRoomOwner(w, r, hub) {
+			return
+		}
+		var document internal.CanvasDocument
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCanvasImportBytes)).Decode(&document); err != nil {
+			internal.LogError("Error decoding canvas import for room %s: %v", hub.Id, err)
+			http.Error(w, "Invalid canvas document", http.StatusBadRequest)
+			return
+		}
+		if err := document.Validate(hub.Canvas); err != nil {
+			internal.LogWarning("Rejected canvas import for room %s: %v", hub.Id, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		internal.LogInfo("Importing canvas with %d ops into room %s", len(document.Ops), hub.Id)
+		if err := hub.LoadCanvas(document.Ops); err != nil {
+			status := http.StatusConflict
+			if errors.Is(err, internal.ErrRoomClosed) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
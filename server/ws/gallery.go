@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"server/internal"
+)
+
+// HandleGetGallery lists the drawings of the room's recent prompt challenges, newest first
+func HandleGetGallery(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(hub.Gallery.List()); err != nil {
+		internal.LogError("Error encoding gallery response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGalleryPNG renders a challenge's canvas as it was when drawing time ran out, or with a playerId in the
+// path only what that player drew
+func HandleGalleryPNG(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	challenge, ok := hub.Gallery.Get(r.PathValue("challengeId"))
+	if !ok {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	ops := challenge.Ops()
+	if playerId := r.PathValue("playerId"); playerId != "" {
+		ops, ok = challenge.EntryOps(playerId)
+		if !ok {
+			http.Error(w, "Drawing not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	// challenge ids start over when the server restarts, so the same URL can show another drawing later
+	w.Header().Set("Cache-Control", "no-store")
+
+	img := internal.RenderOps(ops, challenge.Width, challenge.Height, challenge.Background)
+	if err := png.Encode(w, img); err != nil {
+		internal.LogError("Error encoding gallery PNG for room %s: %v", hub.Id, err)
+		return
+	}
+}
@@ -2,7 +2,9 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/netip"
 	"server/internal"
 	"time"
 
@@ -26,6 +28,8 @@ type MessagePayload struct {
 	PlayerName  string    `json:"playerName"`
 	PlayerEmoji string    `json:"playerEmoji"`
 	Timestamp   time.Time `json:"timestamp"`
+	// Team keeps the message within the sender's team in team mode
+	Team bool `json:"team"`
 }
 
 type PlayerEventPayload struct {
@@ -40,12 +44,56 @@ type DrawMessagePayload struct {
 }
 
 type PathMessagePayload struct {
-	Points []struct {
-		X float64 `json:"x"`
-		Y float64 `json:"y"`
-	} `json:"points"`
-	Color       string  `json:"color"`
-	StrokeWidth float64 `json:"strokeWidth"`
+	Points      []internal.Point `json:"points"`
+	Color       string           `json:"color"`
+	StrokeWidth float64          `json:"strokeWidth"`
+}
+
+type FillMessagePayload struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Color string  `json:"color"`
+}
+
+type ImagePlaceMessagePayload struct {
+	ImageId  string  `json:"imageId"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Scale    float64 `json:"scale"`
+	Rotation float64 `json:"rotation"`
+}
+
+type GameStartMessagePayload struct {
+	Mode        string   `json:"mode"`
+	Rounds      int      `json:"rounds"`
+	TurnSeconds int      `json:"turnSeconds"`
+	Packs       []string `json:"packs"`
+	Theme       string   `json:"theme"`
+}
+
+type ChooseWordMessagePayload struct {
+	Word string `json:"word"`
+}
+
+// PromptVoteMessagePayload picks the drawing of PlayerId as the favourite of a prompt round
+type PromptVoteMessagePayload struct {
+	PlayerId string `json:"playerId"`
+}
+
+// ModerationMessagePayload is shared by the host actions and votes; each uses the fields it needs
+type ModerationMessagePayload struct {
+	PlayerId  string   `json:"playerId"`
+	PlayerIds []string `json:"playerIds"`
+	Enabled   bool     `json:"enabled"`
+	Password  string   `json:"password"`
+	Team      string   `json:"team"`
+	Minutes   int      `json:"minutes"`
+	MaxUses   int      `json:"maxUses"`
+}
+
+type CursorMessagePayload struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 type ClearMessagePayload struct {
@@ -70,8 +118,72 @@ func parseWebsocketMessage[T any](websocketMessage []byte) (T, error) {
 	return msg, nil
 }
 
-func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// remoteIP is the address bans are checked against; it is the peer's address, not any forwarding header
+func remoteIP(r *http.Request) string {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return addrPort.Addr().Unmap().String()
+}
+
+// HandleWebSocket connects a player to the room given by ?room=, the default room when it is left out,
+// or a spectator when ?role=spectator is given.
+// Private rooms also need ?password= or ?invite= with a token from an invite link.
+func HandleWebSocket(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	query := r.URL.Query()
+	roomId := query.Get("room")
+	if roomId == "" {
+		roomId = internal.DefaultRoomId
+	}
+	hub, ok := rooms.Get(roomId)
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	role := query.Get("role")
+	if role != "" && role != "player" && role != "spectator" {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// browsers keep the identity the server gave them on their first visit; new ones get one with the upgrade
+	responseHeader := http.Header{}
+	var identity string
+	if cookie, err := r.Cookie(internal.IdentityCookie); err == nil && internal.ValidIdentity(cookie.Value) {
+		identity = cookie.Value
+	} else {
+		identity = internal.NewIdentity()
+		responseHeader.Add("Set-Cookie", (&http.Cookie{
+			Name:     internal.IdentityCookie,
+			Value:    identity,
+			Path:     "/",
+			MaxAge:   int(internal.IdentityCookieMaxAge.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}).String())
+	}
+	ip := remoteIP(r)
+
+	if ban, banned := internal.Bans.Check(identity, ip, hub.Id); banned {
+		internal.LogInfo("Refused banned connection from %s to room %s: %s", r.RemoteAddr, hub.Id, ban.Reason)
+		internal.IncrementModerationAction("ban_rejected")
+		http.Error(w, "You are banned: "+ban.Reason, http.StatusForbidden)
+		return
+	}
+
+	if err := hub.Access.Check(hub.Id, identity, query.Get("password"), query.Get("invite"), time.Now()); err != nil {
+		internal.LogInfo("Refused connection from %s to private room %s: %v", r.RemoteAddr, hub.Id, err)
+		internal.IncrementWebSocketError("access_denied")
+		status := http.StatusForbidden
+		if errors.Is(err, internal.ErrPasswordRequired) || errors.Is(err, internal.ErrInviteRequired) {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		internal.LogError("Error upgrading to WebSocket: %v", err)
 		internal.IncrementWebSocketError("upgrade_failed")
@@ -85,18 +197,40 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 	player := internal.Player{
 		Id:          "",
 		Conn:        conn,
+		Identity:    identity,
+		IP:          ip,
+		Token:       internal.NewConnectionToken(),
+		Spectator:   role == "spectator",
 		PlayerName:  "",
 		PlayerEmoji: "",
+		Send:        make(chan []byte, internal.PlayerSendBuffer),
+	}
+
+	// all writes to the connection go through the player's send queue
+	go player.WritePump()
+
+	// Register immediately - no conditions needed, unless the room closed in the meantime
+	if !hub.Connect(&player) {
+		close(player.Send)
+		internal.DecrementWebSocketConnection()
+		return
 	}
 
-	// Register immediately - no conditions needed
-	hub.Register <- &player
+	// spectators never join, so they get the room as it stands right away
+	if player.Spectator {
+		internal.LogInfo("Spectator connected to room %s from %s", hub.Id, r.RemoteAddr)
+		hub.SendRoomInfo(&player)
+		hub.SendCanvasSync(&player)
+		hub.SendGameState(&player)
+	}
+
+	// name is what the connection last asked to join as, for logging
+	var name string
 
 	defer func() {
-		internal.LogInfo("Connection closing for player: %s (%s %s)", player.Id, player.PlayerName, player.PlayerEmoji)
-		// Broadcast player leave event before unregistering
-		hub.BroadcastPlayerLeave(&player)
-		hub.Unregister <- &player
+		internal.LogInfo("Connection closing for player: %s", name)
+		// the hub tells everyone the player left when it drops them
+		hub.Disconnect(&player)
 		internal.DecrementWebSocketConnection()
 		conn.Close()
 	}()
@@ -115,7 +249,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 		}
 
 		// show received message with first 50 characters
-		internal.LogDebug("Received message: %s", string(websocketMessage[:50]))
+		internal.LogDebug("Received message: %s", string(websocketMessage[:min(len(websocketMessage), 50)]))
 
 		msg, err := parseWebsocketMessage[WsMessage](websocketMessage)
 		if err != nil {
@@ -127,6 +261,12 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 		// Track received message by type
 		internal.IncrementWebSocketMessage(msg.Type)
 
+		// spectators only watch, whatever they send
+		if player.Spectator {
+			internal.LogDebug("Ignoring %s message from spectator", msg.Type)
+			continue
+		}
+
 		switch msg.Type {
 		case "join":
 			payload, err := parseWebsocketMessage[JoinMessagePayload](msg.Payload)
@@ -135,14 +275,10 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 				internal.IncrementWebSocketError("parse_failed")
 				continue
 			}
-			// fill missing data
-			internal.LogInfo("Player joined with id %s, name: %s, emoji: %s", payload.Id, payload.PlayerName, payload.PlayerEmoji)
-			player.Id = payload.Id
-			player.PlayerName = payload.PlayerName
-			player.PlayerEmoji = payload.PlayerEmoji
-
-			internal.IncrementPlayerJoined()
-			hub.BroadcastPlayerJoin(&player)
+			// the hub fills in the player's details once they have a seat, which in a full room means waiting;
+			// from then on they belong to the hub, so this goroutine logs the name it asked for
+			name = payload.PlayerName
+			hub.RequestSeat(&player, payload.Id, payload.PlayerName, payload.PlayerEmoji)
 
 		case "message":
 			payload, err := parseWebsocketMessage[MessagePayload](msg.Payload)
@@ -153,7 +289,8 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 			}
 			internal.LogInfo("Player %s sent a chat message", payload.PlayerName)
 			internal.IncrementChatMessage()
-			hub.Broadcast <- websocketMessage
+			// the hub checks chat against the word during a turn before anyone sees it
+			hub.SendChat(&player, payload.Message, payload.Team, websocketMessage)
 		case "draw":
 			payload, err := parseWebsocketMessage[DrawMessagePayload](msg.Payload)
 			if err != nil {
@@ -161,7 +298,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 				internal.IncrementWebSocketError("parse_failed")
 				continue
 			}
-			internal.LogDebug("Player %s drawing at (%f, %f)", player.PlayerName, payload.X, payload.Y)
+			internal.LogDebug("Player %s drawing at (%f, %f)", name, payload.X, payload.Y)
 			internal.IncrementDrawEvent()
 			hub.BroadcastDraw(&player, payload.X, payload.Y, "", 0)
 		case "path":
@@ -171,12 +308,102 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 				internal.IncrementWebSocketError("parse_failed")
 				continue
 			}
-			internal.LogDebug("Player %s drawing path with %d points, color: %s, width: %f", player.PlayerName, len(payload.Points), payload.Color, payload.StrokeWidth)
+			internal.LogDebug("Player %s drawing path with %d points, color: %s, width: %f", name, len(payload.Points), payload.Color, payload.StrokeWidth)
+			if len(payload.Points) > internal.MaxPathPoints || payload.StrokeWidth > internal.MaxStrokeWidth {
+				internal.LogWarning("Player %s sent a path beyond the stroke limits, clamping it", name)
+			}
+			points, strokeWidth := internal.ClampStroke(payload.Points, payload.StrokeWidth)
 			internal.IncrementPathEvent()
-			internal.AddPathPoints(float64(len(payload.Points)))
-			hub.BroadcastPath(&player, payload.Points, payload.Color, payload.StrokeWidth)
+			internal.AddPathPoints(float64(len(points)))
+			hub.BroadcastPath(&player, points, payload.Color, strokeWidth)
+		case "fill":
+			payload, err := parseWebsocketMessage[FillMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing fill payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			internal.LogDebug("Player %s filling at (%f, %f) with %s", name, payload.X, payload.Y, payload.Color)
+			internal.IncrementFillEvent()
+			hub.BroadcastFill(&player, payload.X, payload.Y, payload.Color)
+		case "image_place":
+			payload, err := parseWebsocketMessage[ImagePlaceMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing image place payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			if internal.Images == nil || !internal.Images.Exists(payload.ImageId) {
+				internal.LogWarning("Player %s tried to place unknown image %s", name, payload.ImageId)
+				continue
+			}
+			if payload.Scale <= 0 || payload.Scale > internal.MaxImageScale {
+				internal.LogWarning("Player %s sent image scale %f out of range", name, payload.Scale)
+				continue
+			}
+			internal.LogDebug("Player %s placing image %s at (%f, %f)", name, payload.ImageId, payload.X, payload.Y)
+			internal.IncrementImagePlaceEvent()
+			hub.BroadcastImagePlace(&player, payload.ImageId, payload.X, payload.Y, payload.Scale, payload.Rotation)
+		case "game_start":
+			payload, err := parseWebsocketMessage[GameStartMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing game start payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			internal.LogInfo("Player %s asked to start a game", name)
+			hub.StartGame(&player, internal.GameOptions{
+				Mode:        payload.Mode,
+				Rounds:      payload.Rounds,
+				TurnSeconds: payload.TurnSeconds,
+				Packs:       payload.Packs,
+				Theme:       payload.Theme,
+			})
+		case "choose_word":
+			payload, err := parseWebsocketMessage[ChooseWordMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing choose word payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			hub.ChooseWord(&player, payload.Word)
+		case "prompt_vote":
+			payload, err := parseWebsocketMessage[PromptVoteMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing prompt vote payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			hub.VotePrompt(&player, payload.PlayerId)
+		case "kick", "ban", "mute", "unmute", "lock_drawing", "transfer_host", "host_only_clear", "set_password", "invite_only", "create_invite", "end_game", "assign_team", "vote_kick", "vote_clear":
+			payload, err := parseWebsocketMessage[ModerationMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing %s payload: %v", msg.Type, err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			internal.LogInfo("Player %s sent moderation action %s", name, msg.Type)
+			hub.SendModeration(internal.ModerationCommand{
+				Type:      msg.Type,
+				Player:    &player,
+				TargetId:  payload.PlayerId,
+				TargetIds: payload.PlayerIds,
+				Enabled:   payload.Enabled,
+				Password:  payload.Password,
+				Team:      payload.Team,
+				Minutes:   payload.Minutes,
+				MaxUses:   payload.MaxUses,
+			})
+		case "cursor":
+			payload, err := parseWebsocketMessage[CursorMessagePayload](msg.Payload)
+			if err != nil {
+				internal.LogError("Error parsing cursor payload: %v", err)
+				internal.IncrementWebSocketError("parse_failed")
+				continue
+			}
+			hub.UpdateCursor(&player, payload.X, payload.Y)
 		case "clear":
-			internal.LogInfo("Player %s cleared the canvas", player.PlayerName)
+			internal.LogInfo("Player %s cleared the canvas", name)
 			internal.IncrementClearEvent()
 			hub.BroadcastClear(&player)
 		default:
@@ -187,10 +414,7 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 
 func HandleGetPlayers(w http.ResponseWriter, r *http.Request, hub *internal.Hub) {
 	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	w.Header().Set("Access-Control-Max-Age", "86400") // 24 hours
+	setCORSHeaders(w, "GET, OPTIONS")
 
 	// Handle preflight OPTIONS request
 	if r.Method == "OPTIONS" {
@@ -202,10 +426,13 @@ func HandleGetPlayers(w http.ResponseWriter, r *http.Request, hub *internal.Hub)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	players := hub.GetActivePlayers()
+	players := hub.ActivePlayers()
 	if err := json.NewEncoder(w).Encode(players); err != nil {
 		internal.LogError("Error encoding players response: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/internal"
+	"strings"
+	"time"
+)
+
+// HandleImageUpload accepts a PNG or JPEG either as the raw request body or as the "image" field of a multipart form.
+// Uploads take the bearer token of a connection to the room and count against that browser's quota.
+func HandleImageUpload(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "POST, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if internal.Images == nil {
+		http.Error(w, "Image uploads are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	// only someone connected to the room can upload, so images can't be stored in bulk by a script
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	identity, ok := hub.TokenIdentity(token)
+	if !ok {
+		internal.LogWarning("Rejected image upload to room %s from %s without a connection token", hub.Id, r.RemoteAddr)
+		internal.IncrementImageUpload("unauthorized")
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := internal.Images.Allow(identity, time.Now()); err != nil {
+		internal.LogWarning("Rejected image upload to room %s from %s: %v", hub.Id, r.RemoteAddr, err)
+		internal.IncrementImageUpload("quota")
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	// leave some room for multipart framing on top of the image itself
+	body := http.MaxBytesReader(w, r.Body, internal.MaxImageUploadBytes+64<<10)
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = body
+		file, _, formErr := r.FormFile("image")
+		if formErr != nil {
+			err = formErr
+		} else {
+			defer file.Close()
+			data, err = io.ReadAll(io.LimitReader(file, internal.MaxImageUploadBytes+1))
+		}
+	} else {
+		data, err = io.ReadAll(body)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || len(data) > internal.MaxImageUploadBytes {
+		internal.IncrementImageUpload("too_large")
+		http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		internal.LogError("Error reading image upload from %s: %v", r.RemoteAddr, err)
+		internal.IncrementImageUpload("invalid")
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+
+	uploaded, err := internal.Images.Save(data)
+	if errors.Is(err, internal.ErrImageStoreFull) {
+		internal.LogError("Rejected image upload from %s: %v", r.RemoteAddr, err)
+		internal.IncrementImageUpload("store_full")
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		internal.LogWarning("Rejected image upload from %s: %v", r.RemoteAddr, err)
+		internal.IncrementImageUpload("invalid")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	internal.LogInfo("Stored image %s (%dx%d) uploaded to room %s by %s", uploaded.Id, uploaded.Width, uploaded.Height, hub.Id, r.RemoteAddr)
+	internal.IncrementImageUpload("stored")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(uploaded); err != nil {
+		internal.LogError("Error encoding image upload response: %v", err)
+	}
+}
+
+func HandleGetImage(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if internal.Images == nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	path, err := internal.Images.Path(r.PathValue("imageId"))
+	if err != nil {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	// images are named by their content hash, so they never change
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, path)
+}
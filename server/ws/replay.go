@@ -0,0 +1,199 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/internal"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func HandleGetSessions(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(hub.Recorder.Summaries()); err != nil {
+		internal.LogError("Error encoding sessions response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleReplay streams a recorded session over a read-only WebSocket.
+// Query parameters: session (defaults to the latest) and speed (1, 4 or 16, defaults to 1).
+func HandleReplay(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	speed := 1
+	if value := r.URL.Query().Get("speed"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(internal.ReplaySpeeds, parsed) {
+			http.Error(w, "Speed must be 1, 4 or 16", http.StatusBadRequest)
+			return
+		}
+		speed = parsed
+	}
+
+	session, ok := hub.Recorder.Get(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		internal.LogError("Error upgrading replay to WebSocket: %v", err)
+		internal.IncrementWebSocketError("upgrade_failed")
+		return
+	}
+	defer conn.Close()
+
+	internal.LogInfo("Replaying session %s of room %s at %dx to %s", session.Id, hub.Id, speed, r.RemoteAddr)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the viewer can't send anything; reading only notices when it goes away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = internal.Replay(ctx, session, speed, func(message []byte) error {
+		return conn.WriteMessage(websocket.TextMessage, message)
+	})
+	if err != nil && ctx.Err() == nil {
+		internal.LogError("Error replaying session %s of room %s: %v", session.Id, hub.Id, err)
+		return
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay finished"))
+}
+
+// parseTimelapseOptions reads the interval and delay (Go durations such as 500ms) and width query parameters
+func parseTimelapseOptions(r *http.Request) (internal.TimelapseOptions, error) {
+	options := internal.TimelapseOptions{
+		Interval: internal.DefaultTimelapseInterval,
+		Delay:    internal.DefaultTimelapseDelay,
+	}
+	query := r.URL.Query()
+
+	if value := query.Get("interval"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return options, fmt.Errorf("invalid interval %q", value)
+		}
+		options.Interval = interval
+	}
+	if value := query.Get("delay"); value != "" {
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 10*time.Millisecond {
+			return options, fmt.Errorf("invalid delay %q", value)
+		}
+		options.Delay = delay
+	}
+	if value := query.Get("width"); value != "" {
+		width, err := strconv.Atoi(value)
+		if err != nil || width <= 0 || width > internal.MaxTimelapseWidth {
+			return options, fmt.Errorf("width must be between 1 and %d", internal.MaxTimelapseWidth)
+		}
+		options.Width = width
+	}
+	return options, nil
+}
+
+// HandleTimelapse renders a recorded session as an animated GIF, or a zip of PNG frames when format is "zip"
+func HandleTimelapse(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms, format string) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	options, err := parseTimelapseOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, ok := hub.Recorder.Get(r.URL.Query().Get("session"))
+	if !ok {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if len(session.Events) == 0 {
+		http.Error(w, "Session has no events", http.StatusNotFound)
+		return
+	}
+
+	contentType := "image/gif"
+	if format == "zip" {
+		contentType = "application/zip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-session-%s.%s"`, hub.Id, session.Id, format))
+
+	// frames are streamed as they are rendered, so once the first one is out a failure can only be logged
+	if format == "zip" {
+		err = internal.WriteTimelapseZip(w, session, options)
+	} else {
+		err = internal.WriteTimelapseGIF(w, session, options)
+	}
+	if err != nil {
+		internal.LogError("Error writing timelapse of session %s in room %s: %v", session.Id, hub.Id, err)
+	}
+}
@@ -0,0 +1,289 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/internal"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CreateRoomRequest is the body of POST /rooms; settings that are left out get their defaults
+type CreateRoomRequest struct {
+	internal.RoomSettings
+	Password   string `json:"password"`
+	InviteOnly bool   `json:"inviteOnly"`
+}
+
+// RoomDetails is what GET /rooms/{id} shows about a room
+type RoomDetails struct {
+	internal.RoomSummary
+	Settings          internal.RoomSettings `json:"settings"`
+	PasswordProtected bool                  `json:"passwordProtected"`
+	InviteOnly        bool                  `json:"inviteOnly"`
+}
+
+// HandleRooms lists the public rooms for the lobby (GET) or creates a room (POST).
+// Each address may create MaxRoomsCreated rooms per RoomCreationWindow; the admin token has no limit.
+func HandleRooms(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, POST, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Method == "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rooms.Summaries()); err != nil {
+			internal.LogError("Error encoding rooms response: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// the admin can open as many rooms as they like, anyone else only a few per address
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || !isAdminToken(token) {
+		if err := rooms.AllowCreate(remoteIP(r), time.Now()); err != nil {
+			internal.LogWarning("Rejected room creation from %s: %v", r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	request := CreateRoomRequest{RoomSettings: internal.DefaultRoomSettings()}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid room", http.StatusBadRequest)
+		return
+	}
+	hub, ownerToken, err := rooms.Create(request.RoomSettings, request.Password, request.InviteOnly)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, internal.ErrTooManyRooms) {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	internal.LogInfo("Room %s created from %s", hub.Id, r.RemoteAddr)
+
+	// the owner token is only ever shown here
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/rooms/"+hub.Id)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"room":       roomDetails(hub),
+		"ownerToken": ownerToken,
+	}); err != nil {
+		internal.LogError("Error encoding room response: %v", err)
+	}
+}
+
+func roomDetails(hub *internal.Hub) RoomDetails {
+	return RoomDetails{
+		RoomSummary:       hub.Summary(),
+		Settings:          hub.CurrentSettings(),
+		PasswordProtected: hub.Access.HasPassword(),
+		InviteOnly:        hub.Access.InviteOnly(),
+	}
+}
+
+// checkRoomOwner answers the request itself unless it carries the room's owner token or the admin token as a bearer token
+func checkRoomOwner(w http.ResponseWriter, r *http.Request, hub *internal.Hub) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && (hub.IsOwner(token) || isAdminToken(token)) {
+		return true
+	}
+	internal.LogWarning("Rejected request to manage room %s from %s", hub.Id, r.RemoteAddr)
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// checkRoomHost is checkRoomOwner that also lets in the room's host, with the token of their connection
+func checkRoomHost(w http.ResponseWriter, r *http.Request, hub *internal.Hub) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if identity, connected := hub.TokenIdentity(token); ok && connected && hub.Moderation.IsHost(identity) {
+		return true
+	}
+	return checkRoomOwner(w, r, hub)
+}
+
+// checkRoomAccess answers the request itself unless the room is public or the request carries the token of a
+// connection in the room, the owner token or the admin token as a bearer token. Where a header can't be set,
+// like in image links, ?token= takes a connection token; the longer lived tokens are kept out of URLs.
+func checkRoomAccess(w http.ResponseWriter, r *http.Request, hub *internal.Hub) bool {
+	if !hub.Access.Private() {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && (hub.IsOwner(token) || isAdminToken(token)) {
+		return true
+	}
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if _, connected := hub.TokenIdentity(token); connected {
+		return true
+	}
+	internal.LogWarning("Rejected request for private room %s from %s", hub.Id, r.RemoteAddr)
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, "This room is private", http.StatusUnauthorized)
+	return false
+}
+
+// HandleRoom shows a room (GET), changes its settings and access (PATCH) or closes it (DELETE).
+// Changing or closing a room takes its owner token or the admin token. A private room is only shown to someone in it
+// or with one of those tokens, like its other endpoints.
+func HandleRoom(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, PATCH, DELETE, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "PATCH" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.Method {
+	case "GET":
+		if !checkRoomAccess(w, r, hub) {
+			return
+		}
+	case "PATCH":
+		if !checkRoomOwner(w, r, hub) {
+			return
+		}
+		var update internal.RoomUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&update); err != nil {
+			http.Error(w, "Invalid room update", http.StatusBadRequest)
+			return
+		}
+		if err := hub.Update(update); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, internal.ErrRoomClosed) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		internal.LogInfo("Room %s updated from %s", hub.Id, r.RemoteAddr)
+	case "DELETE":
+		if !checkRoomOwner(w, r, hub) {
+			return
+		}
+		if hub.Id == internal.DefaultRoomId {
+			http.Error(w, "The default room can't be deleted", http.StatusForbidden)
+			return
+		}
+		if !rooms.Remove(hub.Id, "the room was deleted") {
+			http.Error(w, "Room not found", http.StatusNotFound)
+			return
+		}
+		internal.LogInfo("Room %s deleted from %s", hub.Id, r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(roomDetails(hub)); err != nil {
+		internal.LogError("Error encoding room response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// HandleGetRoomPlayers lists the players in a room, like /players does for the default room.
+// Private rooms only list them for someone in the room or with the owner token.
+func HandleGetRoomPlayers(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if !checkRoomAccess(w, r, hub) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(hub.ActivePlayers()); err != nil {
+		internal.LogError("Error encoding players response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleLobby streams the room list: first every public room as "rooms", then a
+// "room_created", "room_updated" or "room_closed" event whenever one changes
+func HandleLobby(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		internal.LogError("Error upgrading lobby to WebSocket: %v", err)
+		internal.IncrementWebSocketError("upgrade_failed")
+		return
+	}
+	defer conn.Close()
+
+	// subscribe before taking the list so no change can fall in between
+	updates := rooms.Lobby.Subscribe()
+	defer rooms.Lobby.Unsubscribe(updates)
+
+	if err := conn.WriteJSON(map[string]any{"type": "rooms", "payload": rooms.Summaries()}); err != nil {
+		internal.LogError("Error writing room list: %v", err)
+		return
+	}
+
+	go func() {
+		for update := range updates {
+			if err := conn.WriteMessage(websocket.TextMessage, update); err != nil {
+				break
+			}
+		}
+		// dropped for falling behind, or the reader below has already returned
+		conn.Close()
+	}()
+
+	// the lobby is read-only; reading just notices when the client goes away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
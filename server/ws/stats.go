@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/internal"
+	"slices"
+	"strconv"
+)
+
+// HandleLeaderboard lists the top players, ranked by the stat in ?sort= (points by default)
+func HandleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if internal.Stats == nil {
+		http.Error(w, "Player stats are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = "points"
+	}
+	if !slices.Contains(internal.LeaderboardSorts, sortBy) {
+		http.Error(w, "Invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	limit := internal.DefaultLeaderboardSize
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > internal.MaxLeaderboardSize {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(internal.Stats.Leaderboard(sortBy, limit)); err != nil {
+		internal.LogError("Error encoding leaderboard response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleGetPlayerStats shows the stats with the id a player is given in room_info, as listed on the leaderboard
+func HandleGetPlayerStats(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if internal.Stats == nil {
+		http.Error(w, "Player stats are disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	stats, err := internal.Stats.Get(r.PathValue("id"))
+	if errors.Is(err, internal.ErrPlayerNotFound) {
+		http.Error(w, "Player not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		internal.LogError("Error encoding player stats response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,122 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"server/internal"
+	"strings"
+)
+
+// maxWordListBytes caps the size of an uploaded custom word list
+const maxWordListBytes = 64 << 10
+
+// HandleGetWordPacks lists the word packs rooms can play with
+func HandleGetWordPacks(w http.ResponseWriter, r *http.Request) {
+	setCORSHeaders(w, "GET, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(internal.WordPacks.Packs()); err != nil {
+		internal.LogError("Error encoding word packs response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// HandleRoomWords manages a room's custom word list. PUT replaces it with either a JSON object
+// {"words": [...]} or plain text with one word per line; DELETE removes it.
+// The list holds the answers, so it takes the host's connection token, the owner token or the admin token,
+// and it isn't shown while a game is running.
+func HandleRoomWords(w http.ResponseWriter, r *http.Request, rooms *internal.Rooms) {
+	setCORSHeaders(w, "GET, PUT, DELETE, OPTIONS")
+
+	// Handle preflight OPTIONS request
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	hub, ok := rooms.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkRoomHost(w, r, hub) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		// the host may be playing too, and would see the answers
+		if hub.Game.Phase() != internal.GamePhaseIdle {
+			http.Error(w, "A game is running in this room", http.StatusConflict)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if err := json.NewEncoder(w).Encode(map[string]any{"words": hub.Game.CustomWords()}); err != nil {
+			internal.LogError("Error encoding custom words for room %s: %v", hub.Id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	case "PUT":
+		body := http.MaxBytesReader(w, r.Body, maxWordListBytes)
+
+		var words []string
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var list struct {
+				Words []string `json:"words"`
+			}
+			if err := json.NewDecoder(body).Decode(&list); err != nil {
+				http.Error(w, "Invalid word list", http.StatusBadRequest)
+				return
+			}
+			words = list.Words
+		} else {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				http.Error(w, "Invalid word list", http.StatusBadRequest)
+				return
+			}
+			words = strings.Split(string(data), "\n")
+		}
+
+		words, err := internal.CleanWords(words)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(words) < internal.WordChoiceCount || len(words) > internal.MaxCustomWords {
+			http.Error(w, fmt.Sprintf("A word list needs between %d and %d words", internal.WordChoiceCount, internal.MaxCustomWords), http.StatusBadRequest)
+			return
+		}
+
+		internal.LogInfo("Room %s now has %d custom words", hub.Id, len(words))
+		hub.Game.SetCustomWords(words)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		internal.LogInfo("Removing the custom words of room %s", hub.Id)
+		hub.Game.SetCustomWords(nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}